@@ -25,6 +25,7 @@ import (
 	"github.com/etkecc/honoroit/internal/matrix"
 	mxconfig "github.com/etkecc/honoroit/internal/matrix/config"
 	"github.com/etkecc/honoroit/internal/metrics"
+	"github.com/etkecc/honoroit/internal/store"
 )
 
 var (
@@ -75,8 +76,10 @@ func main() {
 	}))
 	initShutdown()
 
-	ctab.MustAddJob("0 15 * * *", bot.AutoCloseRequests)
+	ctab.MustAddJob("0 * * * *", bot.AutoCloseRequests)
+	ctab.MustAddJob("*/5 * * * *", bot.CheckSLA)
 	ctab.MustAddJob("* * * * *", bot.SyncIssues)
+	ctab.MustAddJob("* * * * *", bot.ExpireSurveys)
 
 	go e.Start(cfg.Port) //nolint:errcheck // nobody cares
 
@@ -143,8 +146,12 @@ func initBot(cfg *config.Config, rdm *redmine.Redmine) error {
 	if err != nil {
 		return err
 	}
+	st, err := store.New(lp.GetDB(), cfg.DB.Dialect)
+	if err != nil {
+		return err
+	}
 	mxc := mxconfig.New(lp)
-	bot, err = matrix.NewBot(lp, &log, mxc, rdm, cfg.Prefix, cfg.RoomID, cfg.CacheSize, cfg.NoEncryptionWarning)
+	bot, err = matrix.NewBot(lp, &log, mxc, rdm, st, cfg.Prefix, cfg.RoomID, cfg.CacheSize, cfg.NoEncryptionWarning)
 	return err
 }
 
@@ -160,7 +167,7 @@ func initShutdown() {
 }
 
 func shutdown() {
-	// drain cron before stopping the bot: AutoCloseRequests/SyncIssues call into the matrix client bot.Stop() tears down
+	// drain cron before stopping the bot: AutoCloseRequests/CheckSLA/SyncIssues/ExpireSurveys call into the matrix client bot.Stop() tears down
 	ctabCtx, ctabCancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer ctabCancel()
 	if err := ctab.Shutdown(ctabCtx); err != nil {
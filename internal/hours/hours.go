@@ -0,0 +1,234 @@
+package hours
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	_ "time/tzdata" // the docker image doesn't have system timezones
+)
+
+// DateLayout is the layout of holiday dates
+const DateLayout = "2006-01-02"
+
+// maxDays limits the search of the next business day, to avoid infinite loops on schedules without business days
+const maxDays = 366
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// interval of business time within a day, in minutes since midnight
+type interval struct {
+	start int
+	end   int
+}
+
+// Schedule of business hours
+type Schedule struct {
+	loc      *time.Location
+	days     map[time.Weekday][]interval
+	holidays map[string]bool
+}
+
+// Parse business hours schedule.
+// weekly is a comma-separated list of "DAYS HH:MM-HH:MM [HH:MM-HH:MM...]" entries, e.g. "mon-fri 09:00-18:00, sat 10:00-14:00",
+// holidays is a comma-separated list of dates in the YYYY-MM-DD format.
+// Empty weekly schedule means 24/7 business hours (holidays are still respected)
+func Parse(timezone, weekly, holidays string) (*Schedule, error) {
+	loc, err := time.LoadLocation(strings.TrimSpace(timezone))
+	if err != nil {
+		return nil, err
+	}
+	s := &Schedule{loc: loc, days: map[time.Weekday][]interval{}, holidays: map[string]bool{}}
+
+	if strings.TrimSpace(weekly) == "" {
+		for _, day := range weekdays {
+			s.days[day] = []interval{{start: 0, end: 24 * 60}}
+		}
+	}
+	for _, entry := range strings.Split(weekly, ",") {
+		if err := s.parseEntry(strings.Fields(strings.ToLower(entry))); err != nil {
+			return nil, err
+		}
+	}
+	for _, intervals := range s.days {
+		sort.Slice(intervals, func(i, j int) bool { return intervals[i].start < intervals[j].start })
+	}
+
+	for _, date := range strings.Split(holidays, ",") {
+		date = strings.TrimSpace(date)
+		if date == "" {
+			continue
+		}
+		if _, err := time.Parse(DateLayout, date); err != nil {
+			return nil, fmt.Errorf("invalid holiday date %q: %w", date, err)
+		}
+		s.holidays[date] = true
+	}
+
+	return s, nil
+}
+
+func (s *Schedule) parseEntry(fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid business hours entry %q, expected DAYS HH:MM-HH:MM", strings.Join(fields, " "))
+	}
+	days, err := parseDays(fields[0])
+	if err != nil {
+		return err
+	}
+	for _, field := range fields[1:] {
+		iv, err := parseInterval(field)
+		if err != nil {
+			return err
+		}
+		for _, day := range days {
+			s.days[day] = append(s.days[day], iv)
+		}
+	}
+	return nil
+}
+
+func parseDays(days string) ([]time.Weekday, error) {
+	from, to, isRange := strings.Cut(days, "-")
+	fromDay, ok := weekdays[from]
+	if !ok {
+		return nil, fmt.Errorf("invalid day %q", from)
+	}
+	if !isRange {
+		return []time.Weekday{fromDay}, nil
+	}
+	toDay, ok := weekdays[to]
+	if !ok {
+		return nil, fmt.Errorf("invalid day %q", to)
+	}
+	list := []time.Weekday{fromDay}
+	for day := fromDay; day != toDay; {
+		day = (day + 1) % 7
+		list = append(list, day)
+	}
+	return list, nil
+}
+
+func parseInterval(value string) (interval, error) {
+	from, to, ok := strings.Cut(value, "-")
+	if !ok {
+		return interval{}, fmt.Errorf("invalid time range %q, expected HH:MM-HH:MM", value)
+	}
+	start, err := parseTime(from)
+	if err != nil {
+		return interval{}, err
+	}
+	end, err := parseTime(to)
+	if err != nil {
+		return interval{}, err
+	}
+	if end <= start {
+		return interval{}, fmt.Errorf("invalid time range %q, end should be after start", value)
+	}
+	return interval{start: start, end: end}, nil
+}
+
+func parseTime(value string) (int, error) {
+	hh, mm, ok := strings.Cut(value, ":")
+	if !ok {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	hours, err := strconv.Atoi(hh)
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	minutes, err := strconv.Atoi(mm)
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// IsOpen returns true if the time is within business hours
+func (s *Schedule) IsOpen(t time.Time) bool {
+	t = t.In(s.loc)
+	for _, iv := range s.intervals(t) {
+		if !t.Before(iv[0]) && t.Before(iv[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// NextOpen returns the start of the next business hours period, or t itself if it's within business hours.
+// Zero time is returned if there are no business hours within a year
+func (s *Schedule) NextOpen(t time.Time) time.Time {
+	t = t.In(s.loc)
+	day := midnight(t)
+	for i := 0; i < maxDays; i++ {
+		for _, iv := range s.intervals(day) {
+			if t.Before(iv[1]) {
+				if t.After(iv[0]) {
+					return t
+				}
+				return iv[0]
+			}
+		}
+		day = day.AddDate(0, 0, 1)
+	}
+	return time.Time{}
+}
+
+// Elapsed returns the business time between from and to
+func (s *Schedule) Elapsed(from, to time.Time) time.Duration {
+	if !to.After(from) {
+		return 0
+	}
+	from = from.In(s.loc)
+	to = to.In(s.loc)
+
+	var elapsed time.Duration
+	for day := midnight(from); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, iv := range s.intervals(day) {
+			start, end := iv[0], iv[1]
+			if start.Before(from) {
+				start = from
+			}
+			if end.After(to) {
+				end = to
+			}
+			if end.After(start) {
+				elapsed += end.Sub(start)
+			}
+		}
+	}
+	return elapsed
+}
+
+// intervals returns business hours of the day as absolute time ranges
+func (s *Schedule) intervals(t time.Time) [][2]time.Time {
+	if s.holidays[t.Format(DateLayout)] {
+		return nil
+	}
+	day := midnight(t)
+	ranges := make([][2]time.Time, 0, len(s.days[t.Weekday()]))
+	for _, iv := range s.days[t.Weekday()] {
+		ranges = append(ranges, [2]time.Time{at(day, iv.start), at(day, iv.end)})
+	}
+	return ranges
+}
+
+func midnight(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func at(day time.Time, minutes int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+}
@@ -0,0 +1,69 @@
+package hours
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type hoursSuite struct {
+	suite.Suite
+	schedule *Schedule
+}
+
+func (s *hoursSuite) SetupTest() {
+	s.T().Helper()
+	schedule, err := Parse("UTC", "mon-fri 09:00-13:00 14:00-18:00, sat 10:00-12:00", "2024-01-03")
+	s.Require().NoError(err)
+	s.schedule = schedule
+}
+
+func (s *hoursSuite) TestParseInvalid() {
+	_, err := Parse("Nowhere/Unknown", "", "")
+	s.Error(err)
+	_, err = Parse("UTC", "mon 18:00-09:00", "")
+	s.Error(err)
+	_, err = Parse("UTC", "someday 09:00-18:00", "")
+	s.Error(err)
+	_, err = Parse("UTC", "", "01/02/2024")
+	s.Error(err)
+}
+
+func (s *hoursSuite) TestIsOpen() {
+	s.True(s.schedule.IsOpen(time.Date(2024, 1, 1, 9, 0, 0, 0, time.UTC)))    // monday
+	s.False(s.schedule.IsOpen(time.Date(2024, 1, 1, 13, 30, 0, 0, time.UTC))) // lunch
+	s.False(s.schedule.IsOpen(time.Date(2024, 1, 3, 10, 0, 0, 0, time.UTC)))  // holiday
+	s.True(s.schedule.IsOpen(time.Date(2024, 1, 6, 11, 0, 0, 0, time.UTC)))   // saturday
+	s.False(s.schedule.IsOpen(time.Date(2024, 1, 7, 11, 0, 0, 0, time.UTC)))  // sunday
+}
+
+func (s *hoursSuite) TestAlwaysOpen() {
+	schedule, err := Parse("UTC", "", "")
+	s.Require().NoError(err)
+	from := time.Date(2024, 1, 6, 22, 0, 0, 0, time.UTC)
+	s.True(schedule.IsOpen(from))
+	s.Equal(48*time.Hour, schedule.Elapsed(from, from.Add(48*time.Hour)))
+}
+
+func (s *hoursSuite) TestNextOpen() {
+	friday := time.Date(2024, 1, 5, 19, 0, 0, 0, time.UTC)
+	s.Equal(time.Date(2024, 1, 6, 10, 0, 0, 0, time.UTC), s.schedule.NextOpen(friday))
+
+	tuesday := time.Date(2024, 1, 2, 18, 30, 0, 0, time.UTC)
+	s.Equal(time.Date(2024, 1, 4, 9, 0, 0, 0, time.UTC), s.schedule.NextOpen(tuesday)) // skipping holiday
+
+	open := time.Date(2024, 1, 4, 15, 0, 0, 0, time.UTC)
+	s.Equal(open, s.schedule.NextOpen(open))
+}
+
+func (s *hoursSuite) TestElapsed() {
+	from := time.Date(2024, 1, 5, 17, 0, 0, 0, time.UTC) // friday
+	to := time.Date(2024, 1, 8, 10, 0, 0, 0, time.UTC)   // monday
+	s.Equal(4*time.Hour, s.schedule.Elapsed(from, to))   // 1h friday + 2h saturday + 1h monday
+	s.Equal(time.Duration(0), s.schedule.Elapsed(to, from))
+}
+
+func TestHours(t *testing.T) {
+	suite.Run(t, new(hoursSuite))
+}
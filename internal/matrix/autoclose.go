@@ -0,0 +1,117 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etkecc/go-linkpearl"
+	"golang.org/x/exp/slices"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// AutoCloseRequests warns customers about inactive requests and closes them once the warning period is over
+func (b *Bot) AutoCloseRequests() {
+	ctx := context.Background()
+	inactivity := b.getDuration(ctx, config.AutoCloseInactivity)
+	if inactivity == 0 {
+		b.log.Info().Msg("auto-close is disabled")
+		return
+	}
+	lead := b.getDuration(ctx, config.AutoCloseWarning)
+	if lead >= inactivity {
+		lead = 0
+	}
+	exempt := strings.Split(b.cfg.Get(ctx, config.AutoCloseExempt.Key), ",")
+
+	tickets, err := b.store.ListOpenTickets(ctx)
+	if err != nil {
+		b.log.Error().Err(err).Msg("cannot list open tickets")
+		return
+	}
+	if len(tickets) == 0 {
+		b.log.Info().Msg("no threads to close")
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, ticket := range tickets {
+		if slices.Contains(exempt, ticket.State) {
+			continue
+		}
+		b.autoCloseRequest(ctx, ticket, now, inactivity, lead)
+	}
+}
+
+// autoCloseRequest warns the customer or closes the request, depending on the time passed since the last message
+func (b *Bot) autoCloseRequest(ctx context.Context, ticket *store.Ticket, now time.Time, inactivity, lead time.Duration) {
+	threadID := ticket.ThreadID
+	lastEvt := b.getLastThreadMessage(ctx, threadID)
+	if lastEvt == nil {
+		b.log.Info().Any("threadID", threadID).Msg("no last event fount")
+		return
+	}
+	lastTS := time.UnixMilli(lastEvt.Timestamp).UTC()
+	inactive := b.elapsed(ctx, config.AutoCloseBusinessHours, lastTS, now)
+	// the warning was sent after the last message, so any reply from the customer cancels the close
+	warned := ticket.WarnedAt.After(lastTS)
+
+	if lead > 0 && !warned {
+		if inactive >= inactivity-lead {
+			b.warnAutoClose(ctx, ticket, lead, now)
+		}
+		return
+	}
+	if inactive < inactivity {
+		return
+	}
+	if lead > 0 && b.elapsed(ctx, config.AutoCloseBusinessHours, ticket.WarnedAt, now) < lead {
+		return
+	}
+
+	// set relates_to to the thread
+	lastEvt.RoomID = b.operatorsRoom(ticket)
+	content := lastEvt.Content.AsMessage()
+	content.RelatesTo = linkpearl.RelatesTo(threadID)
+	lastEvt.Content.Parsed = content
+	b.closeRequest(ctx, lastEvt, true)
+}
+
+// warnAutoClose notifies the customer and operators that the request will be closed soon
+func (b *Bot) warnAutoClose(ctx context.Context, ticket *store.Ticket, lead time.Duration, now time.Time) {
+	period := formatDuration(lead)
+	if b.cfg.Get(ctx, config.Silent.Key) != "true" {
+		text := b.cfg.Get(ctx, config.TextAutoCloseWarning.Key)
+		if strings.Contains(text, "%s") {
+			text = fmt.Sprintf(text, period)
+		}
+		b.SendNotice(ctx, ticket.RoomID, text, nil)
+	}
+	b.SendNotice(ctx, b.operatorsRoom(ticket), "no activity for a while, the request will be closed automatically in "+period+" unless the customer replies", nil, linkpearl.RelatesTo(ticket.ThreadID))
+
+	if err := b.store.SetWarnedAt(ctx, ticket.ThreadID, now); err != nil {
+		b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot store auto-close warning time")
+	}
+}
+
+// formatDuration returns human-readable duration, rounded to days, hours or minutes
+func formatDuration(d time.Duration) string {
+	unit := "hour"
+	n := int(d.Round(time.Hour) / time.Hour)
+	if n == 0 {
+		unit = "minute"
+		n = int(d.Round(time.Minute) / time.Minute)
+	}
+	if n >= 24 && n%24 == 0 {
+		unit = "day"
+		n /= 24
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	return strconv.Itoa(n) + " " + unit
+}
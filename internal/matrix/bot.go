@@ -15,6 +15,7 @@ import (
 	"maunium.net/go/mautrix/id"
 
 	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/store"
 )
 
 // TypingTimeout in milliseconds, used to avoid stuck typing status
@@ -25,12 +26,17 @@ type Bot struct {
 	cfg                 *config.Manager
 	log                 *zerolog.Logger
 	redmine             *redmine.Redmine
+	store               *store.Store
 	lp                  *linkpearl.Linkpearl
 	mu                  *kit.Mutex
 	syncing             bool
 	namesCache          *lru.Cache[id.UserID, [2]string]
 	profilesCache       *lru.Cache[id.UserID, *MSC4144Profile]
 	eventsCache         *lru.Cache[id.EventID, id.EventID]
+	typingSent          *lru.Cache[id.RoomID, time.Time]    // when the bot typing was sent into the room
+	typingTargets       *lru.Cache[id.RoomID, []id.RoomID]  // rooms where the typing of the source room is relayed
+	typingThreads       *lru.Cache[id.UserID, typingThread] // the last thread where the operator sent a message
+	humanRequests       *lru.Cache[id.EventID, time.Time]   // when the customer asked for a human operator, until an operator replies
 	prefix              string
 	roomID              id.RoomID
 	roomConfigured      bool
@@ -44,6 +50,7 @@ func NewBot(
 	log *zerolog.Logger,
 	cfg *config.Manager,
 	rdm *redmine.Redmine,
+	st *store.Store,
 	prefix string,
 	roomID string,
 	cacheSize int,
@@ -61,6 +68,22 @@ func NewBot(
 	if err != nil {
 		return nil, err
 	}
+	typingSent, err := lru.New[id.RoomID, time.Time](cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	typingTargets, err := lru.New[id.RoomID, []id.RoomID](cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	typingThreads, err := lru.New[id.UserID, typingThread](cacheSize)
+	if err != nil {
+		return nil, err
+	}
+	humanRequests, err := lru.New[id.EventID, time.Time](cacheSize)
+	if err != nil {
+		return nil, err
+	}
 
 	bot := &Bot{
 		lp:                  lp,
@@ -68,9 +91,14 @@ func NewBot(
 		cfg:                 cfg,
 		log:                 log,
 		redmine:             rdm,
+		store:               st,
 		namesCache:          namesCache,
 		profilesCache:       profilesCache,
 		eventsCache:         eventsCache,
+		typingSent:          typingSent,
+		typingTargets:       typingTargets,
+		typingThreads:       typingThreads,
+		humanRequests:       humanRequests,
 		prefix:              prefix,
 		roomID:              id.RoomID(roomID),
 		roomConfigured:      isRoomConfigured(roomID),
@@ -80,43 +108,11 @@ func NewBot(
 		bot.log.Warn().Msg("the operators room is not configured. Please, set operators room id to the `HONOROIT_ROOMID` env var. The bot won't work until that.")
 	}
 	bot.ignoreBefore = bot.cfg.Mautrix015Migration(context.Background())
+	bot.migrateMappings(context.Background())
 
 	return bot, nil
 }
 
-// TODO: make it configurable
-func (b *Bot) AutoCloseRequests() {
-	ctx := context.Background()
-	maxTS := time.Now().UTC().Add(-7 * 24 * time.Hour).UnixMilli()
-	threadIDs := b.getThreadIDs(ctx)
-	if len(threadIDs) == 0 {
-		b.log.Info().Msg("no threads to close")
-		return
-	}
-
-	for _, threadID := range threadIDs {
-		// not an actual support thread - ignore
-		if _, err := b.findRoomID(ctx, threadID); err != nil {
-			continue
-		}
-		lastEvt := b.getLastThreadMessage(ctx, threadID)
-		if lastEvt == nil {
-			b.log.Info().Any("threadID", threadID).Msg("no last event fount")
-			continue
-		}
-		// set relates_to to the thread
-		lastEvt.RoomID = b.roomID
-		content := lastEvt.Content.AsMessage()
-		content.RelatesTo = linkpearl.RelatesTo(threadID)
-		lastEvt.Content.Parsed = content
-
-		// if last event timestamp is older than 7d - close the thread
-		if lastEvt.Timestamp < maxTS {
-			b.closeRequest(ctx, lastEvt, true)
-		}
-	}
-}
-
 // Start performs matrix /sync
 func (b *Bot) Start() error {
 	b.initSync()
@@ -2,15 +2,20 @@ package matrix
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	"github.com/etkecc/go-linkpearl"
+	"golang.org/x/exp/slices"
 	"maunium.net/go/mautrix"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
 
 	"github.com/etkecc/honoroit/internal/matrix/config"
 	"github.com/etkecc/honoroit/internal/metrics"
+	"github.com/etkecc/honoroit/internal/store"
 )
 
 func (b *Bot) parseCommand(message string) []string {
@@ -38,22 +43,49 @@ func (b *Bot) readCommand(message string) string {
 func (b *Bot) runCommand(ctx context.Context, command string, evt *event.Event) {
 	switch command {
 	case "done", "complete", "close":
-		go metrics.RequestDone()
 		b.closeRequest(ctx, evt, false)
+	case "reopen":
+		b.reopenRequest(ctx, evt)
+	case "status":
+		b.statusRequest(ctx, evt)
+	case "assign", "claim", "unassign":
+		b.assignRequest(ctx, command, evt)
+	case "mine":
+		b.listAssignedRequests(ctx, evt)
+	case "tag":
+		b.tagRequest(ctx, evt)
+	case "priority":
+		b.priorityRequest(ctx, evt)
+	case "macro":
+		b.macroRequest(ctx, evt)
+	case "transcript":
+		b.transcriptRequest(ctx, evt)
+	case "merge":
+		b.mergeRequest(ctx, evt)
+	case "move":
+		b.moveRequest(ctx, evt)
+	case "history":
+		b.historyRequest(ctx, evt)
+	case "search":
+		b.searchRequest(ctx, evt)
+	case "reindex":
+		b.reindexRequest(ctx, evt)
 	case "rename":
 		b.renameRequest(ctx, evt)
 	case "invite":
 		b.inviteRequest(ctx, evt)
 	case "start":
 		b.startRequest(ctx, evt)
-		go metrics.RequestNew()
 	case "count":
 		b.countRequest(ctx, evt)
+	case "rule", "rules":
+		b.ruleRequest(ctx, evt)
+	case "queue", "queues":
+		b.queueRequest(ctx, evt)
 	case "config":
 		b.handleConfig(ctx, evt)
 	case "note":
-		// do nothing
-		return
+		b.noteRequest(ctx, evt)
 	default:
 		b.help(ctx, evt)
 	}
@@ -85,10 +117,212 @@ func (b *Bot) renameRequest(ctx context.Context, evt *event.Event) {
 		commandFormatted = strings.Join(commandSliceFormatted[1:], " ")
 	}
 
-	err = b.replace(ctx, threadID, "", "", command, commandFormatted)
+	if _, terr := b.store.GetTicket(ctx, threadID); terr == nil {
+		err = b.store.SetTopic(ctx, threadID, command, commandFormatted)
+		if err == nil {
+			err = b.updateTopic(ctx, threadID)
+		}
+	} else {
+		err = b.replace(ctx, threadID, "", "", command, commandFormatted)
+	}
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+	}
+}
+
+// findThreadTicket returns the open ticket of the thread the command was sent in, sends a notice if there is no such ticket
+func (b *Bot) findThreadTicket(ctx context.Context, evt *event.Event) *store.Ticket {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if evt.Content.AsMessage().RelatesTo == nil {
+		b.SendNotice(ctx, evt.RoomID, "the message doesn't relate to any thread, so I don't know which request you mean.", nil, relatesTo)
+		return nil
+	}
+	threadID, err := b.findThread(evt)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return nil
+	}
+	ticket, err := b.getTicket(ctx, threadID)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return nil
+	}
+	return ticket
+}
+
+func (b *Bot) statusRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	ticket := b.findThreadTicket(ctx, evt)
+	if ticket == nil {
+		return
+	}
+	threadID := ticket.ThreadID
+
+	command := b.parseCommand(evt.Content.AsMessage().Body)
+	if len(command) < 2 {
+		b.SendNotice(ctx, evt.RoomID, "Current status: `"+ticket.State+"`. Available statuses: `"+strings.Join(manualStates, "`, `")+"`", nil, relatesTo)
+		return
+	}
+
+	state := strings.ToLower(command[1])
+	if state == store.StateDone {
+		b.SendNotice(ctx, evt.RoomID, "use `"+b.prefix+" done` to close the request", nil, relatesTo)
+		return
+	}
+	if !slices.Contains(manualStates, state) {
+		b.SendNotice(ctx, evt.RoomID, "unknown status `"+state+"`. Available statuses: `"+strings.Join(manualStates, "`, `")+"`", nil, relatesTo)
+		return
+	}
+	if state == ticket.State {
+		return
+	}
+
+	if err := b.setState(ctx, threadID, state); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	go b.updateIssueStatus(ctx, threadID, state, fmt.Sprintf("_%s (👩‍💼 operator) changed the status to %s_", evt.Sender, state))
+}
+
+func (b *Bot) assignRequest(ctx context.Context, command string, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	ticket := b.findThreadTicket(ctx, evt)
+	if ticket == nil {
+		return
+	}
+
+	var assignee id.UserID
+	switch command {
+	case "claim":
+		assignee = evt.Sender
+	case "assign":
+		args := b.parseCommand(evt.Content.AsMessage().Body)
+		if len(args) < 2 {
+			b.SendNotice(ctx, evt.RoomID, "cannot assign the request - MXID is not specified", nil, relatesTo)
+			return
+		}
+		assignee = id.UserID(args[1])
+		if _, _, err := assignee.Parse(); err != nil {
+			b.SendNotice(ctx, evt.RoomID, "cannot assign the request - invalid MXID: "+err.Error(), nil, relatesTo)
+			return
+		}
+	}
+	if assignee == ticket.Assignee {
+		return
+	}
+
+	if err := b.store.SetAssignee(ctx, ticket.ThreadID, assignee); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if err := b.updateTopic(ctx, ticket.ThreadID); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+	}
+}
+
+func (b *Bot) tagRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	ticket := b.findThreadTicket(ctx, evt)
+	if ticket == nil {
+		return
+	}
+
+	args := b.parseCommand(evt.Content.AsMessage().Body)
+	if len(args) < 3 {
+		tags, err := b.store.GetTags(ctx, ticket.ThreadID)
+		if err != nil {
+			b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+			return
+		}
+		b.SendNotice(ctx, evt.RoomID, "Current tags: `"+strings.Join(tags, "`, `")+"`. Use `"+b.prefix+" tag add TAG` or `"+b.prefix+" tag remove TAG` to change them", nil, relatesTo)
+		return
+	}
+
+	tag := normalizeTag(args[2])
+	if tag == "" {
+		b.SendNotice(ctx, evt.RoomID, "cannot change the request tags - tag is empty", nil, relatesTo)
+		return
+	}
+	var err error
+	switch args[1] {
+	case "add":
+		err = b.store.AddTag(ctx, ticket.ThreadID, tag)
+	case "remove", "rm", "delete":
+		err = b.store.RemoveTag(ctx, ticket.ThreadID, tag)
+	default:
+		b.SendNotice(ctx, evt.RoomID, "unknown tag action `"+args[1]+"`, use `add` or `remove`", nil, relatesTo)
+		return
+	}
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if err := b.updateTopic(ctx, ticket.ThreadID); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+	}
+	go b.updateIssueFields(ctx, ticket.ThreadID)
+}
+
+func (b *Bot) priorityRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	ticket := b.findThreadTicket(ctx, evt)
+	if ticket == nil {
+		return
+	}
+
+	args := b.parseCommand(evt.Content.AsMessage().Body)
+	if len(args) < 2 {
+		b.SendNotice(ctx, evt.RoomID, "Current priority: `"+ticket.Priority+"`. Available priorities: `"+strings.Join(store.Priorities, "`, `")+"`", nil, relatesTo)
+		return
+	}
+	priority := strings.ToLower(args[1])
+	if !slices.Contains(store.Priorities, priority) {
+		b.SendNotice(ctx, evt.RoomID, "unknown priority `"+priority+"`. Available priorities: `"+strings.Join(store.Priorities, "`, `")+"`", nil, relatesTo)
+		return
+	}
+	if priority == ticket.Priority {
+		return
+	}
+
+	if err := b.store.SetPriority(ctx, ticket.ThreadID, priority); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if err := b.updateTopic(ctx, ticket.ThreadID); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+	}
+	go b.updateIssueFields(ctx, ticket.ThreadID)
+}
+
+// normalizeTag converts the tag to lowercase and removes hash sign and separators
+func normalizeTag(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	tag = strings.TrimPrefix(tag, "#")
+	return strings.NewReplacer(",", "", " ", "").Replace(tag)
+}
+
+func (b *Bot) listAssignedRequests(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	tickets, err := b.store.ListOpenTicketsByAssignee(ctx, evt.Sender)
 	if err != nil {
-		b.SendNotice(ctx, b.roomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if len(tickets) == 0 {
+		b.SendNotice(ctx, evt.RoomID, "you don't have any open requests assigned", nil, relatesTo)
+		return
+	}
+
+	var txt strings.Builder
+	txt.WriteString("Open requests assigned to you:\n")
+	for _, ticket := range tickets {
+		topic := ticket.Topic
+		if topic == "" {
+			topic = ticket.Customer.String()
+		}
+		fmt.Fprintf(&txt, "* [%s](https://matrix.to/#/%s/%s) - `%s`, since %s\n", topic, b.operatorsRoom(ticket), ticket.ThreadID, ticket.State, ticket.CreatedAt.Format(time.DateOnly))
 	}
+	b.SendNotice(ctx, evt.RoomID, txt.String(), nil, relatesTo)
 }
 
 func (b *Bot) closeRequest(ctx context.Context, evt *event.Event, auto bool) {
@@ -106,41 +340,49 @@ func (b *Bot) closeRequest(ctx context.Context, evt *event.Event, auto bool) {
 		return
 	}
 
-	threadEvt, err := b.lp.GetClient().GetEvent(ctx, b.roomID, threadID)
-	if err != nil {
-		b.SendNotice(ctx, b.roomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
-		return
-	}
-	linkpearl.ParseContent(threadEvt, b.log)
-	threadMsg := threadEvt.Content.AsMessage()
-	lastEdit := b.getLastEdit(ctx, b.roomID, threadID)
-	if lastEdit != nil {
-		threadMsg = lastEdit.Content.AsMessage()
-	}
-
-	roomID, err := b.findRoomID(ctx, threadID)
+	ticket, err := b.getTicket(ctx, threadID)
 	if err != nil {
 		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
 		return
 	}
+	roomID := ticket.RoomID
+	if !auto {
+		tags, _ := b.store.GetTags(ctx, threadID) //nolint:errcheck // metrics without tags are fine
+		go metrics.RequestDone(ticket.Priority, tags)
+		go b.trackResolution(ctx, ticket, time.Now().UTC())
+	}
 
 	var text string
-	if auto {
+	switch {
+	case auto:
 		text = b.cfg.Get(ctx, config.TextDoneAuto.Key)
-	} else {
+	case evt.Sender == ticket.Customer:
+		text = b.cfg.Get(ctx, config.TextDoneCustomer.Key)
+	default:
 		text = b.cfg.Get(ctx, config.TextDone.Key)
 	}
 	if b.cfg.Get(ctx, config.Silent.Key) != "true" {
 		b.SendNotice(ctx, roomID, text, nil)
 	}
-	go b.closeIssue(ctx, roomID, threadID, text)
+	go b.closeIssue(ctx, threadID, text)
 
-	body, formattedBody := b.getContentBody(threadMsg)
-	body = strings.Replace(body, b.cfg.Get(ctx, config.TextPrefixOpen.Key), "", 1)
-	formattedBody = strings.Replace(formattedBody, b.cfg.Get(ctx, config.TextPrefixOpen.Key), "", 1)
-	err = b.replace(ctx, threadID, b.cfg.Get(ctx, config.TextPrefixDone.Key)+" ", "", body, formattedBody)
+	err = b.setState(ctx, threadID, store.StateDone)
 	if err != nil {
-		b.SendNotice(ctx, b.roomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+	}
+	b.forgetTypingThread(threadID)
+
+	if b.cfg.Get(ctx, config.TranscriptCustomer.Key) == "true" && b.cfg.Get(ctx, config.Silent.Key) != "true" {
+		if closed, cerr := b.store.GetTicket(ctx, threadID); cerr == nil {
+			if err = b.sendTranscript(ctx, closed, roomID, "md", false); err != nil {
+				b.log.Error().Err(err).Str("threadID", threadID.String()).Msg("cannot send transcript to the customer")
+			}
+		}
+	}
+
+	// stay in the room until the customer rates the request, see ExpireSurveys
+	if !auto && b.sendSurvey(ctx, ticket) {
+		return
 	}
 
 	_, err = b.lp.GetClient().LeaveRoom(ctx, roomID)
@@ -150,9 +392,89 @@ func (b *Bot) closeRequest(ctx context.Context, evt *event.Event, auto bool) {
 			b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
 		}
 	}
+}
+
+func (b *Bot) reopenRequest(ctx context.Context, evt *event.Event) {
+	b.log.Debug().Msg("reopening a request")
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if evt.Content.AsMessage().RelatesTo == nil {
+		b.SendNotice(ctx, evt.RoomID, "the message doesn't relate to any thread, so I don't know which request should be reopened.", nil, relatesTo)
+		return
+	}
+	threadID, err := b.findThread(evt)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	ticket, err := b.store.GetTicket(ctx, threadID)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, "cannot find the request of that thread: "+linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if ticket.IsOpen() {
+		b.SendNotice(ctx, evt.RoomID, "the request is not closed, there is nothing to reopen.", nil, relatesTo)
+		return
+	}
+	if ticket.State == store.StateMerged {
+		b.SendNotice(ctx, evt.RoomID, fmt.Sprintf("the request was merged into [another one](https://matrix.to/#/%s/%s), reopen it instead.", b.threadRoom(ctx, ticket.MergedInto), ticket.MergedInto), nil, relatesTo)
+		return
+	}
+	if ticket.State == store.StateMoved {
+		b.SendNotice(ctx, evt.RoomID, fmt.Sprintf("the request was moved to [another queue](https://matrix.to/#/%s/%s), reopen it there.", b.threadRoom(ctx, ticket.MovedTo), ticket.MovedTo), nil, relatesTo)
+		return
+	}
+
+	roomID, err := b.rejoinRoom(ctx, ticket)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if roomID != ticket.RoomID {
+		if err := b.store.SetRoomID(ctx, threadID, roomID); err != nil {
+			b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+			return
+		}
+	}
+	if err := b.setState(ctx, threadID, store.StateOpen); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	go b.updateIssueStatus(ctx, threadID, store.StateOpen, fmt.Sprintf("_%s (👩‍💼 operator) reopened the request_", evt.Sender))
+
+	if b.cfg.Get(ctx, config.Silent.Key) != "true" {
+		b.SendNotice(ctx, roomID, b.cfg.Get(ctx, config.TextReopen.Key), nil)
+	}
+}
+
+// rejoinRoom tries to join the customer room of the closed ticket and invite the customer back,
+// if the room cannot be joined anymore, a new direct room is created
+func (b *Bot) rejoinRoom(ctx context.Context, ticket *store.Ticket) (id.RoomID, error) {
+	if _, err := b.findEventID(ctx, ticket.RoomID); err == nil {
+		return "", errors.New("the customer room already has another open request")
+	}
 
-	b.removeMapping(ctx, threadID.String())
-	b.removeMapping(ctx, roomID.String())
+	if _, err := b.lp.GetClient().JoinRoomByID(ctx, ticket.RoomID); err != nil {
+		b.log.Info().Err(err).Str("roomID", ticket.RoomID.String()).Msg("cannot rejoin the customer room, creating a new one")
+		return b.createDirectRoom(ctx, ticket.Customer)
+	}
+
+	members, err := b.lp.GetClient().StateStore.GetRoomJoinedOrInvitedMembers(ctx, ticket.RoomID)
+	if err != nil {
+		b.log.Warn().Err(err).Str("roomID", ticket.RoomID.String()).Msg("cannot get joined or invited members")
+	}
+	if slices.Contains(members, ticket.Customer) {
+		return ticket.RoomID, nil
+	}
+	_, err = b.lp.GetClient().InviteUser(ctx, ticket.RoomID, &mautrix.ReqInviteUser{
+		Reason: "your request has been reopened",
+		UserID: ticket.Customer,
+	})
+	if err != nil {
+		b.log.Warn().Err(err).Str("roomID", ticket.RoomID.String()).Msg("cannot invite the customer back, creating a new room")
+		b.lp.GetClient().LeaveRoom(ctx, ticket.RoomID) //nolint:errcheck // doesn't matter
+		return b.createDirectRoom(ctx, ticket.Customer)
+	}
+	return ticket.RoomID, nil
 }
 
 func (b *Bot) inviteRequest(ctx context.Context, evt *event.Event) {
@@ -187,10 +509,33 @@ func (b *Bot) startRequest(ctx context.Context, evt *event.Event) {
 	command := b.parseCommand(evt.Content.AsMessage().Body)
 	relatesTo := linkpearl.EventRelatesTo(evt)
 	if len(command) < 2 {
-		b.SendNotice(ctx, b.roomID, "cannot start a new matrix room - MXID is not specified", nil, relatesTo)
+		b.SendNotice(ctx, evt.RoomID, "cannot start a new matrix room - MXID is not specified", nil, relatesTo)
 		return
 	}
 	userID := id.UserID(command[1])
+	roomID, err := b.createDirectRoom(ctx, userID)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	_, err = b.startThread(ctx, roomID, userID, b.getQueueByRoom(ctx, evt.RoomID), "", false)
+	if err != nil {
+		// log handled in the startThread
+		return
+	}
+	newEvent := &event.Event{
+		Sender: evt.Sender,
+		RoomID: roomID,
+	}
+	newContent := &event.MessageEventContent{
+		Body:    b.cfg.Get(ctx, config.TextStart.Key),
+		MsgType: event.MsgNotice,
+	}
+	b.forwardToThread(ctx, newEvent, newContent)
+}
+
+// createDirectRoom creates a new (encrypted, if possible) direct room with the user
+func (b *Bot) createDirectRoom(ctx context.Context, userID id.UserID) (id.RoomID, error) {
 	req := &mautrix.ReqCreateRoom{
 		Invite:   []id.UserID{userID},
 		Preset:   "trusted_private_chat",
@@ -211,40 +556,25 @@ func (b *Bot) startRequest(ctx context.Context, evt *event.Event) {
 
 	resp, err := b.lp.GetClient().CreateRoom(ctx, req)
 	if err != nil {
-		b.SendNotice(ctx, b.roomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
-		return
-	}
-	roomID := resp.RoomID
-	_, err = b.startThread(ctx, roomID, userID, false)
-	if err != nil {
-		// log handled in the startThread
-		return
-	}
-	newEvent := &event.Event{
-		Sender: evt.Sender,
-		RoomID: roomID,
+		return "", err
 	}
-	newContent := &event.MessageEventContent{
-		Body:    b.cfg.Get(ctx, config.TextStart.Key),
-		MsgType: event.MsgNotice,
-	}
-	b.forwardToThread(ctx, newEvent, newContent)
+	return resp.RoomID, nil
 }
 
 func (b *Bot) countRequest(ctx context.Context, evt *event.Event) {
 	command := b.parseCommand(evt.Content.AsMessage().Body)
 	if len(command) < 2 {
-		b.SendNotice(ctx, b.roomID, "cannot count a request - MXID is not specified", nil, linkpearl.EventRelatesTo(evt))
+		b.SendNotice(ctx, evt.RoomID, "cannot count a request - MXID is not specified", nil, linkpearl.EventRelatesTo(evt))
 		return
 	}
 	userID := id.UserID(command[1])
 
-	eventID, _, err := b.newThread(ctx, b.cfg.Get(ctx, config.TextPrefixDone.Key), userID)
+	eventID, _, err := b.newThread(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextPrefixDone.Key), userID, nil)
 	if err != nil {
 		return
 	}
 
-	b.SendNotice(ctx, b.roomID, b.cfg.Get(ctx, config.TextCount.Key), map[string]any{"event_id": evt.ID}, linkpearl.RelatesTo(eventID))
+	b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextCount.Key), map[string]any{"event_id": evt.ID}, linkpearl.RelatesTo(eventID))
 }
 
 func (b *Bot) handleConfig(ctx context.Context, evt *event.Event) {
@@ -282,7 +612,7 @@ func (b *Bot) listConfigOption(ctx context.Context, evt *event.Event, key string
 	key = strings.ToLower(key)
 	option := config.Options.Find(key)
 	if option == nil {
-		b.SendNotice(ctx, b.roomID, "no such option", nil, linkpearl.EventRelatesTo(evt))
+		b.SendNotice(ctx, evt.RoomID, "no such option", nil, linkpearl.EventRelatesTo(evt))
 		return
 	}
 
@@ -306,18 +636,25 @@ func (b *Bot) listConfigOption(ctx context.Context, evt *event.Event, key string
 	txt.WriteString(key)
 	txt.WriteString(" NEW VALUE`")
 
-	b.SendNotice(ctx, b.roomID, txt.String(), nil, linkpearl.EventRelatesTo(evt))
+	b.SendNotice(ctx, evt.RoomID, txt.String(), nil, linkpearl.EventRelatesTo(evt))
 }
 
 func (b *Bot) setConfigOption(ctx context.Context, evt *event.Event, key, value string) {
 	option := config.Options.Find(strings.ToLower(key))
 	if option == nil {
-		b.SendNotice(ctx, b.roomID, "no such option", nil, linkpearl.EventRelatesTo(evt))
+		b.SendNotice(ctx, evt.RoomID, "no such option", nil, linkpearl.EventRelatesTo(evt))
 		return
 	}
-	b.cfg.Set(option.Key, option.Sanitizer(value)).Save(ctx)
+	if option.Validator != nil {
+		if err := option.Validator(value); err != nil {
+			b.SendNotice(ctx, evt.RoomID, key+" has not been updated: "+err.Error(), nil, linkpearl.EventRelatesTo(evt))
+			return
+		}
+	}
+	value = option.Sanitizer(value)
+	b.cfg.Set(option.Key, value).Save(ctx)
 
-	b.SendNotice(ctx, b.roomID, key+" has been updated, new value: `"+value+"`", nil, linkpearl.EventRelatesTo(evt))
+	b.SendNotice(ctx, evt.RoomID, key+" has been updated, new value: `"+value+"`", nil, linkpearl.EventRelatesTo(evt))
 }
 
 func (b *Bot) help(ctx context.Context, evt *event.Event, preamble ...string) {
@@ -325,9 +662,51 @@ func (b *Bot) help(ctx context.Context, evt *event.Event, preamble ...string) {
 
 ` + b.prefix + ` done - close the current request. Customer will receive a message about that and bot will leave the customer's room, thead topic will be prefixed with "[DONE]" suffixed with timestamp
 
+` + b.prefix + ` status - show the current request status and the list of available statuses
+
+` + b.prefix + ` status STATUS - change the request status (open, waiting, onhold, escalated), thread topic will be prefixed accordingly
+
+` + b.prefix + ` reopen - reopen the closed request. Bot will rejoin the customer's room (or create a new one) and the customer will receive a message about that
+
+` + b.prefix + ` assign MXID - assign the request to the MXID, assignee will be mentioned on new customer messages
+
+` + b.prefix + ` claim - assign the request to yourself
+
+` + b.prefix + ` unassign - remove the request assignee
+
+` + b.prefix + ` mine - list open requests assigned to you (can be sent outside of threads)
+
+` + b.prefix + ` tag add TAG - add the TAG to the request
+
+` + b.prefix + ` tag remove TAG - remove the TAG from the request
+
+` + b.prefix + ` priority low|normal|high|urgent - change the request priority
+
+` + b.prefix + ` macro NAME - send the NAME macro (canned response) to the customer
+
+` + b.prefix + ` macro list - list all macros
+
+` + b.prefix + ` macro save NAME TEXT - create or update the NAME macro, placeholders {customer}, {request} and {operator} will be replaced with the customer name, request ordinal and operator name
+
+` + b.prefix + ` macro delete NAME - delete the NAME macro
+
+` + b.prefix + ` transcript [md|html|json] - upload the request conversation transcript into the thread (markdown by default)
+
+` + b.prefix + ` merge THREAD_EVENT_ID - merge the current request into the request of another thread, e.g. when the customer opened 2 requests about the same issue
+
+` + b.prefix + ` move QUEUE - move the current request to the QUEUE, a new thread will be created in the queue room and the current thread will be closed
+
+` + b.prefix + ` history - list previous requests of the customer
+
+` + b.prefix + ` history MXID - list requests of the MXID (can be sent outside of threads)
+
+` + b.prefix + ` search QUERY - find requests by the text of their messages (can be sent outside of threads)
+
+` + b.prefix + ` reindex - rebuild the search index from the threads history (can be sent outside of threads)
+
 ` + b.prefix + ` rename TEXT - replaces thread topic text to the TEXT
 
-` + b.prefix + ` note NOTE - a message prefixed with "!ho note" won't be sent anywhere, it's a safe place to keep notes for other operations in a thread with a customer
+` + b.prefix + ` note NOTE - a message prefixed with "!ho note" won't be sent to the customer, it's a safe place to keep notes for other operators in a thread with a customer. Notes are stored with the request, included in transcripts (marked as internal) and added to the Redmine issue as private notes
 
 ` + b.prefix + ` invite - invite yourself into the customer's room
 
@@ -335,6 +714,24 @@ func (b *Bot) help(ctx context.Context, evt *event.Event, preamble ...string) {
 
 ` + b.prefix + ` count MXID - count a request from MXID and their homeserver, but don't actually create a room or invite them
 
+` + b.prefix + ` queue list - list queues (operators rooms) with their routing rules
+
+` + b.prefix + ` queue add NAME ROOM_ID - add a new queue, the bot will join the ROOM_ID room (invite it first)
+
+` + b.prefix + ` queue rules NAME RULES - set comma-separated routing rules of the queue, e.g. "keyword:invoice, homeserver:example.com, source:telegram, user:@*:example.com", rules are evaluated in the order queues were added, requests that don't match any rule go to the default queue (see the queue.default config option)
+
+` + b.prefix + ` queue greetings NAME TEXT - set greetings of the queue, empty TEXT means the default greetings
+
+` + b.prefix + ` queue receipts NAME REACTION - set the reaction added to operator messages read by the customer in the queue, "off" disables read receipts, empty REACTION means the receipts.reaction config option
+
+` + b.prefix + ` queue delete NAME - delete the queue without open requests
+
+` + b.prefix + ` rule list - list triage rules, that classify new requests by the first customer message
+
+` + b.prefix + ` rule save NAME ACTIONS REGEX - create or update the triage rule, ACTIONS are comma-separated "tag:TAG", "priority:PRIORITY", "queue:QUEUE" and "assignee:MXID", e.g. "` + b.prefix + ` rule save refunds tag:billing,priority:high refund|chargeback"
+
+` + b.prefix + ` rule delete NAME - delete the triage rule
+
 ` + b.prefix + ` config - list all config options with descriptions
 
 ` + b.prefix + ` config KEY - get config KEY's value and description
@@ -346,5 +743,5 @@ func (b *Bot) help(ctx context.Context, evt *event.Event, preamble ...string) {
 		text = preamble[0] + "\n\n" + text
 	}
 
-	b.SendNotice(ctx, b.roomID, text, nil, linkpearl.EventRelatesTo(evt))
+	b.SendNotice(ctx, evt.RoomID, text, nil, linkpearl.EventRelatesTo(evt))
 }
@@ -9,8 +9,9 @@ import (
 )
 
 const (
-	configKey     = "cc.etke.honoroit.config"
-	mautrix015key = "mautrix015migration"
+	configKey           = "cc.etke.honoroit.config"
+	mautrix015key       = "mautrix015migration"
+	ticketsMigrationKey = "ticketsmigration"
 )
 
 // Manager of configs
@@ -48,6 +49,16 @@ func (m *Manager) Mautrix015Migration(ctx context.Context) int64 {
 	return int64(migratedInt)
 }
 
+// TicketsMigrated returns true if account data mappings were already imported into the tickets store
+func (m *Manager) TicketsMigrated(ctx context.Context) bool {
+	return m.getConfig(ctx)[ticketsMigrationKey] == "true"
+}
+
+// SetTicketsMigrated marks account data mappings as imported into the tickets store
+func (m *Manager) SetTicketsMigrated(ctx context.Context) {
+	m.Set(ticketsMigrationKey, "true").Save(ctx)
+}
+
 // Get config value
 func (m *Manager) Get(ctx context.Context, key string) string {
 	v := m.getConfig(ctx)[key]
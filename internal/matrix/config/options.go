@@ -1,9 +1,15 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/etkecc/go-mxidwc"
+
+	"github.com/etkecc/honoroit/internal/hours"
 )
 
 var (
@@ -80,6 +86,230 @@ var (
 			return "m.notice"
 		},
 	}
+	HoursTimezone = &Option{
+		Key:         "hours.timezone",
+		Default:     "UTC",
+		Description: "timezone of the business hours, e.g. `Europe/Berlin`",
+		Sanitizer: func(s string) string {
+			s = strings.TrimSpace(s)
+			if _, err := time.LoadLocation(s); err != nil || s == "" {
+				return "UTC"
+			}
+			return s
+		},
+	}
+	HoursWeekly = &Option{
+		Key:         "hours.weekly",
+		Description: "comma-separated weekly business hours, e.g. `mon-fri 09:00-13:00 14:00-18:00, sat 10:00-14:00`, empty value means 24/7",
+		Sanitizer: func(s string) string {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if _, err := hours.Parse("UTC", s, ""); err != nil {
+				return ""
+			}
+			return s
+		},
+		Validator: func(s string) error {
+			_, err := hours.Parse("UTC", strings.ToLower(strings.TrimSpace(s)), "")
+			return err
+		},
+	}
+	HoursHolidays = &Option{
+		Key:         "hours.holidays",
+		Description: "comma-separated list of holiday dates in the YYYY-MM-DD format, e.g. `2024-12-25,2025-01-01`",
+		Sanitizer: func(s string) string {
+			parts := strings.Split(s, ",")
+			valid := make([]string, 0, len(parts))
+			for _, part := range parts {
+				part = strings.TrimSpace(part)
+				if _, err := time.Parse(hours.DateLayout, part); err == nil {
+					valid = append(valid, part)
+				}
+			}
+			return strings.Join(valid, ",")
+		},
+	}
+	AutoCloseInactivity = &Option{
+		Key:         "autoclose.inactivity",
+		Default:     "7d",
+		Description: "requests without new messages for that period will be closed automatically, e.g. `7d`, `36h`, `0` disables auto-close",
+		Sanitizer:   sanitizeDuration,
+		Validator:   validateDuration,
+	}
+	AutoCloseWarning = &Option{
+		Key:         "autoclose.warning",
+		Default:     "1d",
+		Description: "how long before the automatic close the customer should be warned, e.g. `1d`, `12h`, `0` disables the warning",
+		Sanitizer:   sanitizeDuration,
+		Validator:   validateDuration,
+	}
+	AutoCloseExempt = &Option{
+		Key:         "autoclose.exempt",
+		Default:     "onhold,escalated",
+		Description: "comma-separated list of request statuses that should never be closed automatically",
+		Sanitizer: func(s string) string {
+			parts := strings.Split(s, ",")
+			for i, part := range parts {
+				parts[i] = strings.ToLower(strings.TrimSpace(part))
+			}
+			return strings.Join(parts, ",")
+		},
+	}
+	AutoCloseBusinessHours = &Option{
+		Key:         "autoclose.businesshours",
+		Default:     "false",
+		Description: "if set to true, only business hours (see `hours.*` options) are counted towards the auto-close inactivity period",
+		Sanitizer: func(s string) string {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s == "yes" || s == "true" || s == "1" || s == "y" {
+				return "true"
+			}
+			return "false"
+		},
+	}
+	SLAResponse = &Option{
+		Key:         "sla.response",
+		Default:     "0",
+		Description: "first response SLA - time from the first customer message to the first operator reply, e.g. `4h`, `0` disables warnings",
+		Sanitizer:   sanitizeDuration,
+		Validator:   validateDuration,
+	}
+	SLAResolution = &Option{
+		Key:         "sla.resolution",
+		Default:     "0",
+		Description: "resolution SLA - time from the first customer message to the request close, e.g. `5d`, `0` disables warnings",
+		Sanitizer:   sanitizeDuration,
+		Validator:   validateDuration,
+	}
+	SLAWarning = &Option{
+		Key:         "sla.warning",
+		Default:     "1h",
+		Description: "how long before the SLA breach operators should be warned in the thread, e.g. `1h`",
+		Sanitizer:   sanitizeDuration,
+		Validator:   validateDuration,
+	}
+	SLABusinessHours = &Option{
+		Key:         "sla.businesshours",
+		Default:     "false",
+		Description: "if set to true, only business hours (see `hours.*` options) are counted towards SLA",
+		Sanitizer: func(s string) string {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s == "yes" || s == "true" || s == "1" || s == "y" {
+				return "true"
+			}
+			return "false"
+		},
+	}
+	CustomerCommands = &Option{
+		Key:         "customer.commands",
+		Default:     "true",
+		Description: "if set to true, customers can use commands in their 1:1 rooms: status, close, transcript, human",
+		Sanitizer: func(s string) string {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s == "yes" || s == "true" || s == "1" || s == "y" {
+				return "true"
+			}
+			return "false"
+		},
+	}
+	CustomerPrefix = &Option{
+		Key:         "customer.prefix",
+		Default:     "!",
+		Description: "prefix of customer commands, e.g. `!` for `!status`",
+		Sanitizer:   strings.TrimSpace,
+	}
+	QueueDefault = &Option{
+		Key:         "queue.default",
+		Default:     "",
+		Description: "name of the queue for requests that don't match any routing rule, empty means the main operators room",
+		Sanitizer: func(s string) string {
+			return strings.ToLower(strings.TrimSpace(s))
+		},
+	}
+	CSATEnabled = &Option{
+		Key:         "csat.enabled",
+		Default:     "false",
+		Description: "if set to true, the customer will be asked to rate the request when it is marked as done",
+		Sanitizer: func(s string) string {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s == "yes" || s == "true" || s == "1" || s == "y" {
+				return "true"
+			}
+			return "false"
+		},
+	}
+	CSATTimeout = &Option{
+		Key:         "csat.timeout",
+		Default:     "1h",
+		Description: "how long to wait for the customer rating before leaving the room, e.g. `1h`",
+		Sanitizer:   sanitizeDuration,
+		Validator:   validateDuration,
+	}
+	RedactReactions = &Option{
+		Key:         "redact.reactions",
+		Default:     "true",
+		Description: "if set to true, reactions removed by the customer or operator are removed on the other side, too (deleted messages are always removed)",
+		Sanitizer: func(s string) string {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s == "yes" || s == "true" || s == "1" || s == "y" {
+				return "true"
+			}
+			return "false"
+		},
+	}
+	ReceiptsReaction = &Option{
+		Key:         "receipts.reaction",
+		Default:     "✓",
+		Description: "reaction added to the operator message in the thread when the customer has read it, `off` disables read receipts (can be overridden per queue)",
+		Sanitizer: func(s string) string {
+			s = strings.TrimSpace(s)
+			if strings.EqualFold(s, "off") || strings.EqualFold(s, "false") || strings.EqualFold(s, "no") {
+				return "off"
+			}
+			return s
+		},
+	}
+	TranscriptCustomer = &Option{
+		Key:         "transcript.customer",
+		Default:     "false",
+		Description: "if set to true, the customer will receive the request transcript when the request is marked as done",
+		Sanitizer: func(s string) string {
+			s = strings.ToLower(strings.TrimSpace(s))
+			if s == "yes" || s == "true" || s == "1" || s == "y" {
+				return "true"
+			}
+			return "false"
+		},
+	}
+	RedminePriorities = &Option{
+		Key:         "redmine.priorities",
+		Description: "comma-separated list of request priority to redmine priority ID pairs, e.g. `low=1,normal=2,high=3,urgent=4`",
+		Sanitizer: func(s string) string {
+			parts := strings.Split(s, ",")
+			pairs := make([]string, 0, len(parts))
+			for _, part := range parts {
+				priority, priorityID, ok := strings.Cut(part, "=")
+				if !ok {
+					continue
+				}
+				if _, err := strconv.Atoi(strings.TrimSpace(priorityID)); err != nil {
+					continue
+				}
+				pairs = append(pairs, strings.ToLower(strings.TrimSpace(priority))+"="+strings.TrimSpace(priorityID))
+			}
+			return strings.Join(pairs, ",")
+		},
+	}
+	RedmineTagsField = &Option{
+		Key:         "redmine.tagsfield",
+		Description: "ID of the redmine issue custom field (list with multiple values or text) to store request tags",
+		Sanitizer: func(s string) string {
+			s = strings.TrimSpace(s)
+			if _, err := strconv.Atoi(s); err != nil {
+				return ""
+			}
+			return s
+		},
+	}
 	TextPrefixOpen = &Option{
 		Key:         "text.prefix.open",
 		Default:     "[OPEN]",
@@ -92,6 +322,36 @@ var (
 		Description: "prefix added to the completed thread topics",
 		Sanitizer:   strings.TrimSpace,
 	}
+	TextPrefixWaiting = &Option{
+		Key:         "text.prefix.waiting",
+		Default:     "[WAITING]",
+		Description: "prefix added to the thread topics waiting for the customer",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextPrefixOnHold = &Option{
+		Key:         "text.prefix.onhold",
+		Default:     "[ON HOLD]",
+		Description: "prefix added to the thread topics put on hold",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextPrefixEscalated = &Option{
+		Key:         "text.prefix.escalated",
+		Default:     "[ESCALATED]",
+		Description: "prefix added to the escalated thread topics",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextPrefixMerged = &Option{
+		Key:         "text.prefix.merged",
+		Default:     "[MERGED]",
+		Description: "prefix added to the topics of threads merged into other threads",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextPrefixMoved = &Option{
+		Key:         "text.prefix.moved",
+		Default:     "[MOVED]",
+		Description: "prefix added to the topics of threads moved to other queues",
+		Sanitizer:   strings.TrimSpace,
+	}
 	TextGreetingsBeforeEncryption = &Option{
 		Key:         "text.greetings.before.encryption",
 		Default:     "Warning! This is an encrypted room, there is a high chance that we won't be able to read your messages. Please, **consider using a non-encrypted room**. If there is no other greetings message, that means that we can't read your messages.",
@@ -104,6 +364,12 @@ var (
 		Description: "message sent to the customer on the first contact",
 		Sanitizer:   strings.TrimSpace,
 	}
+	TextGreetingsOffHours = &Option{
+		Key:         "text.greetings.offhours",
+		Default:     "Our team is out of office right now, we will get back to you on %s.",
+		Description: "message sent to the customer on the first contact outside of business hours (see `hours.*` options), `%s` is replaced with the start of the next business hours",
+		Sanitizer:   strings.TrimSpace,
+	}
 	TextGreetingsCustomer = &Option{
 		Key:         "text.greetings.customer",
 		Default:     "Thank you for contacting us! This is your %s request.",
@@ -158,6 +424,138 @@ var (
 		Description: "message sent to customer when request marked as done in the threads room",
 		Sanitizer:   strings.TrimSpace,
 	}
+	TextDoneCustomer = &Option{
+		Key:         "text.done.customer",
+		Default:     "Your request has been closed. If you need help again, please start another 1:1 chat with me to open a new request.",
+		Description: "message sent to customer when they close the request with the close command",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextStatusOpen = &Option{
+		Key:         "text.status.open",
+		Default:     "waiting for an operator",
+		Description: "request status shown to the customer by the status command, `open` state",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextStatusWaiting = &Option{
+		Key:         "text.status.waiting",
+		Default:     "waiting for your reply",
+		Description: "request status shown to the customer by the status command, `waiting` state",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextStatusOnHold = &Option{
+		Key:         "text.status.onhold",
+		Default:     "on hold",
+		Description: "request status shown to the customer by the status command, `onhold` state",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextStatusEscalated = &Option{
+		Key:         "text.status.escalated",
+		Default:     "escalated",
+		Description: "request status shown to the customer by the status command, `escalated` state",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextStatusDone = &Option{
+		Key:         "text.status.done",
+		Default:     "closed",
+		Description: "request status shown to the customer by the status command, `done` state",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextStatusMerged = &Option{
+		Key:         "text.status.merged",
+		Default:     "merged into another request",
+		Description: "request status shown to the customer by the status command, `merged` state",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextStatusMoved = &Option{
+		Key:         "text.status.moved",
+		Default:     "transferred to another team",
+		Description: "request status shown to the customer by the status command, `moved` state",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCustomerStatus = &Option{
+		Key:         "text.customer.status",
+		Default:     "* Request: {request}\n* Status: {status}\n* Opened: {opened}\n* Operator: {operator}",
+		Description: "reply to the customer status command, placeholders: `{request}`, `{status}`, `{opened}`, `{operator}`, lines with empty placeholders are skipped",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCustomerHelp = &Option{
+		Key:         "text.customer.help",
+		Default:     "Available commands:\n\n* `{prefix}status` - show the status of your request\n* `{prefix}close` - close your request\n* `{prefix}transcript` - get the transcript of your request\n* `{prefix}human` - ask for a human operator",
+		Description: "reply to the customer help command, `{prefix}` is replaced with the `customer.prefix` option",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCustomerNoRequest = &Option{
+		Key:         "text.customer.norequest",
+		Default:     "You don't have an open request. Just send a message describing your issue to open one.",
+		Description: "message sent to customer when they use customer commands without an open request",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCustomerNoRequests = &Option{
+		Key:         "text.customer.norequests",
+		Default:     "You don't have any requests in this room yet.",
+		Description: "message sent to customer when they ask for a transcript without any requests in the room",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCustomerClosed = &Option{
+		Key:         "text.customer.closed",
+		Default:     "the request has been closed by the customer {customer}",
+		Description: "notice sent into the thread when the customer closes the request with the close command, `{customer}` is replaced with the customer name",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextHumanOperators = &Option{
+		Key:         "text.human.operators",
+		Default:     "the customer {customer} asks for a human operator",
+		Description: "notice sent into the thread when the customer asks for a human operator with the human command, `{customer}` is replaced with the customer name",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCustomerNotAllowed = &Option{
+		Key:         "text.customer.notallowed",
+		Default:     "Only the person who opened the request can use this command.",
+		Description: "message sent to other members of the customer room when they use customer commands",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextHuman = &Option{
+		Key:         "text.human",
+		Default:     "Operators have been notified, somebody will join the conversation as soon as possible.",
+		Description: "message sent to customer when they ask for a human operator with the human command",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextReopen = &Option{
+		Key:         "text.reopen",
+		Default:     "The operator has reopened your request, you can continue the conversation in this room.",
+		Description: "message sent to customer when request reopened in the threads room",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextMerged = &Option{
+		Key:         "text.merged",
+		Default:     "Your requests have been merged, please continue the conversation in the other room.",
+		Description: "message sent to customer before leaving the room when requests from different rooms are merged",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextAutoCloseWarning = &Option{
+		Key:         "text.autoclose.warning",
+		Default:     "There was no activity for a while. This request will be marked as completed in %s, unless you reply.",
+		Description: "message sent to customer before the request will be automatically marked as done",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCSAT = &Option{
+		Key:         "text.csat",
+		Default:     "How would you rate our support?",
+		Description: "customer satisfaction survey question, sent when the request is marked as done (if `csat.enabled`)",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCSATFallback = &Option{
+		Key:         "text.csat.fallback",
+		Default:     "Please, react to this message with 1️⃣ (poor), 2️⃣, 3️⃣, 4️⃣, or 5️⃣ (excellent), or just send the number.",
+		Description: "instructions added to the survey question for clients without polls support",
+		Sanitizer:   strings.TrimSpace,
+	}
+	TextCSATThanks = &Option{
+		Key:         "text.csat.thanks",
+		Default:     "Thank you for your feedback!",
+		Description: "message sent to the customer after the survey answer",
+		Sanitizer:   strings.TrimSpace,
+	}
 	TextDoneAuto = &Option{
 		Key:         "text.done.auto",
 		Default:     "There were no activity for a while. I've marked this request as completed. If you think that it's not done yet, please start another 1:1 chat with me to open a new request.",
@@ -166,7 +564,7 @@ var (
 	}
 
 	// Options is full list of the all available options
-	Options = ListOfOptions{AllowedUsers, IgnoredRooms, IgnoreNoThread, Silent, MsgType, TextPrefixOpen, TextPrefixDone, TextGreetingsBeforeEncryption, TextGreetings, TextGreetingsCustomer, TextJoin, TextInvite, TextLeave, TextEmptyRoom, TextError, TextStart, TextCount, TextDone, TextDoneAuto}
+	Options = ListOfOptions{AllowedUsers, IgnoredRooms, IgnoreNoThread, Silent, MsgType, HoursTimezone, HoursWeekly, HoursHolidays, AutoCloseInactivity, AutoCloseWarning, AutoCloseExempt, AutoCloseBusinessHours, SLAResponse, SLAResolution, SLAWarning, SLABusinessHours, CustomerCommands, CustomerPrefix, QueueDefault, CSATEnabled, CSATTimeout, RedactReactions, ReceiptsReaction, TranscriptCustomer, RedminePriorities, RedmineTagsField, TextPrefixOpen, TextPrefixDone, TextPrefixWaiting, TextPrefixOnHold, TextPrefixEscalated, TextPrefixMerged, TextPrefixMoved, TextGreetingsBeforeEncryption, TextGreetings, TextGreetingsCustomer, TextGreetingsOffHours, TextJoin, TextInvite, TextLeave, TextEmptyRoom, TextError, TextStart, TextCount, TextDone, TextDoneCustomer, TextStatusOpen, TextStatusWaiting, TextStatusOnHold, TextStatusEscalated, TextStatusDone, TextStatusMerged, TextStatusMoved, TextCustomerStatus, TextCustomerHelp, TextCustomerNoRequest, TextCustomerNoRequests, TextCustomerClosed, TextCustomerNotAllowed, TextHuman, TextHumanOperators, TextReopen, TextMerged, TextAutoCloseWarning, TextCSAT, TextCSATFallback, TextCSATThanks, TextDoneAuto}
 )
 
 type Option struct {
@@ -174,6 +572,7 @@ type Option struct {
 	Default     string
 	Description string
 	Sanitizer   func(s string) string
+	Validator   func(s string) error // optional, invalid values are rejected instead of being sanitized
 }
 
 type ListOfOptions []*Option
@@ -186,3 +585,38 @@ func (l ListOfOptions) Find(key string) *Option {
 	}
 	return nil
 }
+
+// ParseDuration is time.ParseDuration with additional support of days, e.g. `7d`
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+func validateDuration(s string) error {
+	d, err := ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration, use e.g. `30m`, `12h` or `7d`: %w", err)
+	}
+	if d < 0 {
+		return errors.New("duration cannot be negative")
+	}
+	return nil
+}
+
+func sanitizeDuration(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if d, err := ParseDuration(s); err != nil || d < 0 {
+		return "0"
+	}
+	return s
+}
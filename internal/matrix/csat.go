@@ -0,0 +1,263 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/metrics"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// csatMaxScore is the best possible customer satisfaction score
+const csatMaxScore = 5
+
+// csatReactions maps reaction keys to the customer satisfaction scores
+var csatReactions = map[string]int{
+	"1️⃣": 1,
+	"2️⃣": 2,
+	"3️⃣": 3,
+	"4️⃣": 4,
+	"5️⃣": 5,
+}
+
+// ExpireSurveys leaves customer rooms that didn't answer the satisfaction survey in time
+func (b *Bot) ExpireSurveys() {
+	ctx := context.Background()
+	tickets, err := b.store.ListExpiredCSAT(ctx, time.Now().UTC())
+	if err != nil {
+		b.log.Error().Err(err).Msg("cannot list expired surveys")
+		return
+	}
+	for _, ticket := range tickets {
+		expired, err := b.store.ExpireCSAT(ctx, ticket.ThreadID)
+		if err != nil {
+			b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot expire survey")
+			continue
+		}
+		if expired {
+			b.leaveClosedRoom(ctx, ticket.RoomID)
+		}
+	}
+}
+
+// sendSurvey asks the customer to rate the closed request.
+// Returns true if the survey was sent and the bot should stay in the room until the answer or timeout
+func (b *Bot) sendSurvey(ctx context.Context, ticket *store.Ticket) bool {
+	if b.cfg.Get(ctx, config.CSATEnabled.Key) != "true" || b.cfg.Get(ctx, config.Silent.Key) == "true" {
+		return false
+	}
+	timeout := b.getDuration(ctx, config.CSATTimeout)
+	if timeout == 0 {
+		return false
+	}
+
+	question := b.cfg.Get(ctx, config.TextCSAT.Key)
+	fallback := question + "\n\n" + b.cfg.Get(ctx, config.TextCSATFallback.Key)
+	var eventID id.EventID
+	// bridges don't support polls, so only reactions are used
+	if metrics.GetSource(ticket.Customer) == "matrix" {
+		eventID = b.sendSurveyPoll(ctx, ticket.RoomID, question, fallback)
+	} else {
+		eventID = b.sendSurveyReactions(ctx, ticket.RoomID, fallback)
+	}
+	if eventID == "" {
+		return false
+	}
+
+	if err := b.store.SetCSATPending(ctx, ticket.ThreadID, eventID, time.Now().UTC().Add(timeout)); err != nil {
+		b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot store survey")
+		return false
+	}
+	return true
+}
+
+// sendSurveyPoll sends MSC3381 poll, with text fallback for clients that don't support polls
+func (b *Bot) sendSurveyPoll(ctx context.Context, roomID id.RoomID, question, fallback string) id.EventID {
+	poll := &event.PollStartEventContent{}
+	poll.PollStart.Kind = "org.matrix.msc3381.poll.disclosed"
+	poll.PollStart.MaxSelections = 1
+	poll.PollStart.Question.Text = question
+	for score := 1; score <= csatMaxScore; score++ {
+		answer := struct {
+			ID string `json:"id"`
+			event.MSC1767Message
+		}{ID: strconv.Itoa(score)}
+		answer.Text = strings.Repeat("⭐", score)
+		poll.PollStart.Answers = append(poll.PollStart.Answers, answer)
+	}
+	rendered := format.RenderMarkdown(fallback, true, true)
+	fullContent := &event.Content{
+		Parsed: poll,
+		Raw: map[string]any{
+			"body":                    rendered.Body,
+			"org.matrix.msc1767.text": rendered.Body,
+		},
+	}
+
+	resp, err := b.lp.SendMessageEvent(ctx, roomID, event.EventUnstablePollStart, fullContent)
+	if err != nil {
+		b.log.Error().Err(err).Str("roomID", roomID.String()).Msg("cannot send survey poll")
+		return ""
+	}
+	return resp.EventID
+}
+
+// sendSurveyReactions sends the survey question and adds possible answers as reactions
+func (b *Bot) sendSurveyReactions(ctx context.Context, roomID id.RoomID, text string) id.EventID {
+	eventID := b.SendNotice(ctx, roomID, text, nil)
+	if eventID == "" {
+		return ""
+	}
+	for score := 1; score <= csatMaxScore; score++ {
+		if _, err := b.lp.GetClient().SendReaction(ctx, roomID, eventID, strconv.Itoa(score)+"️⃣"); err != nil {
+			b.log.Warn().Err(err).Str("roomID", roomID.String()).Msg("cannot add survey reaction")
+		}
+	}
+	return eventID
+}
+
+// onPollResponse handles survey poll answers
+func (b *Bot) onPollResponse(ctx context.Context, evt *event.Event) {
+	if evt.Sender == b.lp.GetClient().UserID || b.isOperatorsRoom(ctx, evt.RoomID) {
+		return
+	}
+	linkpearl.ParseContent(evt, b.log)
+	content, ok := evt.Content.Parsed.(*event.PollResponseEventContent)
+	if !ok || len(content.Response.Answers) == 0 {
+		return
+	}
+	score, err := strconv.Atoi(content.Response.Answers[0])
+	if err != nil {
+		return
+	}
+	b.handleSurveyAnswer(ctx, evt, content.RelatesTo.EventID, score)
+}
+
+// handleSurveyReaction handles survey answers sent as reactions, returns true if the reaction was a survey answer
+func (b *Bot) handleSurveyReaction(ctx context.Context, evt *event.Event) bool {
+	if b.isOperatorsRoom(ctx, evt.RoomID) {
+		return false
+	}
+	content := evt.Content.AsReaction()
+	score, ok := csatReactions[content.RelatesTo.Key]
+	if !ok {
+		return false
+	}
+	return b.handleSurveyAnswer(ctx, evt, content.RelatesTo.EventID, score)
+}
+
+// handleSurveyReply handles survey answers sent as plain numbers, returns true if the message was a survey answer
+func (b *Bot) handleSurveyReply(ctx context.Context, evt *event.Event, content *event.MessageEventContent) bool {
+	score, err := strconv.Atoi(strings.TrimSpace(content.Body))
+	if err != nil {
+		return false
+	}
+	// the customer already started a new request
+	if _, err = b.store.GetOpenTicketByRoom(ctx, evt.RoomID); err == nil {
+		return false
+	}
+	ticket, err := b.store.GetPendingCSATByRoom(ctx, evt.RoomID)
+	if err != nil {
+		return false
+	}
+	return b.handleSurveyAnswer(ctx, evt, ticket.CSATEventID, score)
+}
+
+// handleSurveyFollowUp posts messages sent while the survey is pending into the closed thread,
+// so they don't open a new request. Returns true if the message was posted
+func (b *Bot) handleSurveyFollowUp(ctx context.Context, evt *event.Event, content *event.MessageEventContent) bool {
+	if _, err := b.store.GetOpenTicketByRoom(ctx, evt.RoomID); err == nil {
+		return false
+	}
+	ticket, err := b.store.GetPendingCSATByRoom(ctx, evt.RoomID)
+	if err != nil || ticket.Customer != evt.Sender {
+		return false
+	}
+
+	replyTo := b.mirroredEvent(ctx, ticket.ThreadID, content.RelatesTo.GetReplyTo())
+	if replyTo != "" {
+		b.clearReply(content)
+	}
+	nameMD, nameHTML := b.getName(ctx, evt.Sender)
+	go b.addIssueNote(ctx, ticket.ThreadID, fmt.Sprintf("_%s (🧑‍🦱customer, after the request was closed)_\n\n%s", evt.Sender, issueText(content)), false)
+	go b.indexMessage(ctx, ticket.ThreadID, evt.ID, content.Body, evt.Timestamp)
+
+	withSenderName(content, nameMD+" (after the request was closed)", nameHTML+" (after the request was closed)")
+	content.RelatesTo = linkpearl.RelatesTo(ticket.ThreadID)
+	if replyTo != "" {
+		content.RelatesTo.SetReplyTo(replyTo)
+	}
+	operatorsRoomID := b.operatorsRoom(ticket)
+	relayID, err := b.lp.Send(ctx, operatorsRoomID, &event.Content{
+		Parsed: content,
+		Raw: map[string]any{
+			"event_id": evt.ID,
+		},
+	})
+	if err != nil {
+		b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot post the message into the closed thread")
+		return true
+	}
+	b.saveRelay(ctx, event.EventMessage, ticket.ThreadID, evt.ID, relayID, operatorsRoomID)
+	return true
+}
+
+// handleSurveyAnswer stores the score, posts it into the thread and leaves the customer room.
+// Returns true if the event was a survey answer
+func (b *Bot) handleSurveyAnswer(ctx context.Context, evt *event.Event, surveyID id.EventID, score int) bool {
+	if surveyID == "" || score < 1 || score > csatMaxScore {
+		return false
+	}
+	ticket, err := b.store.GetTicketByCSATEvent(ctx, surveyID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			b.log.Error().Err(err).Str("eventID", surveyID.String()).Msg("cannot find survey")
+		}
+		return false
+	}
+	if ticket.RoomID != evt.RoomID || ticket.Customer != evt.Sender {
+		return false
+	}
+
+	stored, err := b.store.SetCSATScore(ctx, ticket.ThreadID, score)
+	if err != nil {
+		b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot store survey answer")
+		return true
+	}
+	if !stored { // already answered
+		return true
+	}
+	go metrics.CSAT(score)
+
+	stars := strings.Repeat("⭐", score)
+	b.SendNotice(ctx, b.operatorsRoom(ticket), "customer rated the request: "+stars+" ("+strconv.Itoa(score)+"/"+strconv.Itoa(csatMaxScore)+")", nil, linkpearl.RelatesTo(ticket.ThreadID))
+	if thanks := b.cfg.Get(ctx, config.TextCSATThanks.Key); thanks != "" {
+		b.SendNotice(ctx, ticket.RoomID, thanks, nil)
+	}
+
+	// the bot stays in the room only while waiting for the answer
+	if !ticket.CSATUntil.IsZero() {
+		b.leaveClosedRoom(ctx, ticket.RoomID)
+	}
+	return true
+}
+
+// leaveClosedRoom leaves the customer room, unless there is a new request in it
+func (b *Bot) leaveClosedRoom(ctx context.Context, roomID id.RoomID) {
+	if _, err := b.store.GetOpenTicketByRoom(ctx, roomID); err == nil {
+		return
+	}
+	if _, err := b.lp.GetClient().LeaveRoom(ctx, roomID); err != nil {
+		b.log.Warn().Err(linkpearl.UnwrapError(err)).Str("roomID", roomID.String()).Msg("cannot leave the room")
+	}
+}
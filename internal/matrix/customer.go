@@ -0,0 +1,221 @@
+package matrix
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// customerStates maps ticket states to the config options of their descriptions for customers
+var customerStates = map[string]*config.Option{
+	store.StateOpen:      config.TextStatusOpen,
+	store.StateWaiting:   config.TextStatusWaiting,
+	store.StateOnHold:    config.TextStatusOnHold,
+	store.StateEscalated: config.TextStatusEscalated,
+	store.StateDone:      config.TextStatusDone,
+	store.StateMerged:    config.TextStatusMerged,
+	store.StateMoved:     config.TextStatusMoved,
+}
+
+// handleCustomerCommand handles commands sent by the customer in the 1:1 room,
+// returns true if the message was a command and should not be forwarded to the thread
+func (b *Bot) handleCustomerCommand(ctx context.Context, evt *event.Event, content *event.MessageEventContent) bool {
+	if b.cfg.Get(ctx, config.CustomerCommands.Key) != "true" {
+		return false
+	}
+	prefix := b.cfg.Get(ctx, config.CustomerPrefix.Key)
+	body := strings.TrimSpace(content.Body)
+	if prefix == "" || !strings.HasPrefix(body, prefix) {
+		return false
+	}
+	command := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(body, prefix)))
+
+	switch command {
+	case "status":
+		b.customerStatus(ctx, evt)
+	case "close", "done":
+		b.customerClose(ctx, evt)
+	case "transcript":
+		b.customerTranscript(ctx, evt)
+	case "human", "operator":
+		b.customerHuman(ctx, evt)
+	case "help":
+		b.customerHelp(ctx, evt, prefix)
+	default:
+		return false
+	}
+	return true
+}
+
+func (b *Bot) customerHelp(ctx context.Context, evt *event.Event, prefix string) {
+	b.SendNotice(ctx, evt.RoomID, strings.ReplaceAll(b.cfg.Get(ctx, config.TextCustomerHelp.Key), "{prefix}", prefix), nil)
+}
+
+// getCustomerTicket returns the open ticket of the customer room, sends a notice if there is no such ticket
+// or the sender is not the customer of the ticket
+func (b *Bot) getCustomerTicket(ctx context.Context, evt *event.Event) *store.Ticket {
+	ticket, err := b.store.GetOpenTicketByRoom(ctx, evt.RoomID)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextCustomerNoRequest.Key), nil)
+		return nil
+	}
+	if !b.isTicketCustomer(ctx, evt, ticket) {
+		return nil
+	}
+	return ticket
+}
+
+// isTicketCustomer checks if the sender is the customer of the ticket, sends a notice otherwise
+func (b *Bot) isTicketCustomer(ctx context.Context, evt *event.Event, ticket *store.Ticket) bool {
+	if evt.Sender == ticket.Customer {
+		return true
+	}
+	b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextCustomerNotAllowed.Key), nil)
+	return false
+}
+
+func (b *Bot) customerStatus(ctx context.Context, evt *event.Event) {
+	ticket := b.getCustomerTicket(ctx, evt)
+	if ticket == nil {
+		return
+	}
+
+	var request, operator string
+	if ticket.IssueID != 0 {
+		request = "#" + strconv.FormatInt(ticket.IssueID, 10)
+	} else if count, err := b.store.CountCustomerTickets(ctx, ticket.Customer, ticket.CreatedAt); err == nil && count > 0 {
+		request = humanize.Ordinal(count)
+	}
+	state := ticket.State
+	if option, ok := customerStates[ticket.State]; ok {
+		state = b.cfg.Get(ctx, option.Key)
+	}
+	if ticket.Assignee != "" {
+		operator = b.getDisplayName(ctx, ticket.Assignee)
+	}
+	b.SendNotice(ctx, evt.RoomID, renderPlaceholders(b.cfg.Get(ctx, config.TextCustomerStatus.Key), map[string]string{
+		"request":  request,
+		"status":   state,
+		"opened":   ticket.CreatedAt.Format(time.DateOnly),
+		"operator": operator,
+	}), nil)
+}
+
+// renderPlaceholders replaces {placeholders} in the text line by line, lines with empty placeholders are skipped
+func renderPlaceholders(text string, values map[string]string) string {
+	lines := strings.Split(text, "\n")
+	rendered := make([]string, 0, len(lines))
+	for _, line := range lines {
+		skip := false
+		for key, value := range values {
+			if !strings.Contains(line, "{"+key+"}") {
+				continue
+			}
+			if value == "" {
+				skip = true
+				break
+			}
+			line = strings.ReplaceAll(line, "{"+key+"}", value)
+		}
+		if !skip {
+			rendered = append(rendered, line)
+		}
+	}
+	return strings.Join(rendered, "\n")
+}
+
+// customerClose closes the request on behalf of the customer, as if an operator sent the done command in the thread
+func (b *Bot) customerClose(ctx context.Context, evt *event.Event) {
+	ticket := b.getCustomerTicket(ctx, evt)
+	if ticket == nil {
+		return
+	}
+	name, _ := b.getName(ctx, evt.Sender)
+	operatorsRoomID := b.operatorsRoom(ticket)
+	b.SendNotice(ctx, operatorsRoomID, strings.ReplaceAll(b.cfg.Get(ctx, config.TextCustomerClosed.Key), "{customer}", name), nil, linkpearl.RelatesTo(ticket.ThreadID))
+
+	content := format.RenderMarkdown(b.prefix+" done", false, false)
+	content.RelatesTo = linkpearl.RelatesTo(ticket.ThreadID)
+	b.closeRequest(ctx, &event.Event{
+		ID:      evt.ID,
+		Sender:  evt.Sender,
+		RoomID:  operatorsRoomID,
+		Content: event.Content{Parsed: &content},
+	}, false)
+}
+
+// customerTranscript sends the transcript of the open request, or the last request of the room
+func (b *Bot) customerTranscript(ctx context.Context, evt *event.Event) {
+	ticket, err := b.store.GetOpenTicketByRoom(ctx, evt.RoomID)
+	if err == nil && !b.isTicketCustomer(ctx, evt, ticket) {
+		return
+	}
+	if err != nil {
+		ticket = b.getLastRoomTicket(ctx, evt.Sender, evt.RoomID)
+	}
+	if ticket == nil {
+		b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextCustomerNoRequests.Key), nil)
+		return
+	}
+	if err := b.sendTranscript(ctx, ticket, evt.RoomID, "md", false); err != nil {
+		b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot send transcript to the customer")
+		b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextError.Key), nil)
+	}
+}
+
+// getLastRoomTicket returns the latest ticket of the customer in the room, regardless of its state
+func (b *Bot) getLastRoomTicket(ctx context.Context, customer id.UserID, roomID id.RoomID) *store.Ticket {
+	tickets, err := b.store.ListTicketsByCustomer(ctx, customer)
+	if err != nil {
+		b.log.Error().Err(err).Str("userID", customer.String()).Msg("cannot list customer requests")
+		return nil
+	}
+	for _, ticket := range tickets {
+		if ticket.RoomID == roomID {
+			return ticket
+		}
+	}
+	return nil
+}
+
+// customerHuman notifies operators (the assignee, if any) that the customer wants to talk to a human,
+// operators are notified once until one of them replies
+func (b *Bot) customerHuman(ctx context.Context, evt *event.Event) {
+	ticket := b.getCustomerTicket(ctx, evt)
+	if ticket == nil {
+		return
+	}
+	if b.humanRequests.Contains(ticket.ThreadID) {
+		b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextHuman.Key), nil)
+		return
+	}
+
+	name, _ := b.getName(ctx, evt.Sender)
+	content := &event.MessageEventContent{
+		MsgType:   event.MsgNotice,
+		Body:      strings.ReplaceAll(b.cfg.Get(ctx, config.TextHumanOperators.Key), "{customer}", name),
+		RelatesTo: linkpearl.RelatesTo(ticket.ThreadID),
+	}
+	if ticket.Assignee != "" {
+		content.Body += " (cc " + ticket.Assignee.String() + ")"
+		content.Mentions = &event.Mentions{UserIDs: []id.UserID{ticket.Assignee}}
+	}
+	if _, err := b.lp.Send(ctx, b.operatorsRoom(ticket), &event.Content{Parsed: content}); err != nil {
+		b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot notify operators")
+		b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextError.Key), nil)
+		return
+	}
+	b.humanRequests.Add(ticket.ThreadID, time.Now().UTC())
+	go b.transitionState(ctx, ticket.ThreadID, store.StateWaiting, store.StateOpen)
+	b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextHuman.Key), nil)
+}
@@ -0,0 +1,33 @@
+package matrix
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type customerSuite struct {
+	suite.Suite
+}
+
+func (s *customerSuite) TestRenderPlaceholders() {
+	text := "* Request: {request}\n* Status: {status}\n* Operator: {operator}"
+	tests := []struct {
+		name     string
+		values   map[string]string
+		expected string
+	}{
+		{"all values", map[string]string{"request": "#42", "status": "on hold", "operator": "Alice"}, "* Request: #42\n* Status: on hold\n* Operator: Alice"},
+		{"empty value", map[string]string{"request": "2nd", "status": "closed", "operator": ""}, "* Request: 2nd\n* Status: closed"},
+		{"unknown placeholder", map[string]string{"status": "closed"}, "* Request: {request}\n* Status: closed\n* Operator: {operator}"},
+	}
+	for _, test := range tests {
+		s.Run(test.name, func() {
+			s.Equal(test.expected, renderPlaceholders(text, test.values))
+		})
+	}
+}
+
+func TestCustomer(t *testing.T) {
+	suite.Run(t, new(customerSuite))
+}
@@ -20,12 +20,26 @@ type MSC4144Profile struct {
 	AvatarURL   id.ContentURI `json:"avatar_url"`  // The avatar_url field represents the URL of the avatar image that should be used when rendering the message. This URL must be an MXC URI.
 }
 
+// countCustomerRequests counts threads of the customer and their homeserver across all operators rooms
 func (b *Bot) countCustomerRequests(ctx context.Context, userID id.UserID) (user, hs int, err error) {
+	for _, roomID := range b.getOperatorsRooms(ctx) {
+		roomUser, roomHS, err := b.countRoomRequests(ctx, roomID, userID)
+		if err != nil {
+			return user, hs, err
+		}
+		user += roomUser
+		hs += roomHS
+	}
+
+	return user, hs, nil
+}
+
+func (b *Bot) countRoomRequests(ctx context.Context, roomID id.RoomID, userID id.UserID) (user, hs int, err error) {
 	var from string
 	for {
-		resp, err := b.lp.Threads(ctx, b.roomID)
+		resp, err := b.lp.Threads(ctx, roomID, from)
 		if err != nil {
-			b.log.Error().Err(err).Str("from", from).Str("roomID", b.roomID.String()).Msg("cannot request threads for the room")
+			b.log.Error().Err(err).Str("from", from).Str("roomID", roomID.String()).Msg("cannot request threads for the room")
 			return user, hs, err
 		}
 		for _, evt := range resp.Chunk {
@@ -104,24 +118,6 @@ func (b *Bot) getMSC4144Profie(ctx context.Context, userID id.UserID) *MSC4144Pr
 	return profile
 }
 
-// getThreadIDs returns all thread IDs in the operator room
-func (b *Bot) getThreadIDs(ctx context.Context, fromToken ...string) []id.EventID {
-	threadIDs := []id.EventID{}
-	threads, err := b.lp.Threads(ctx, b.roomID, fromToken...)
-	if err != nil {
-		b.log.Error().Err(err).Msg("cannot get room threads")
-		return threadIDs
-	}
-	for _, thread := range threads.Chunk {
-		threadIDs = append(threadIDs, thread.ID)
-	}
-	if threads.NextBatch == "" {
-		return threadIDs
-	}
-
-	return append(threadIDs, b.getThreadIDs(ctx, threads.NextBatch)...)
-}
-
 // isLastThreadMessageEligible checks if the last message in the thread is eligible for processing
 func (b *Bot) isLastThreadMessageEligible(ctx context.Context, evt *event.Event) (eligible, shouldContinue bool) {
 	// not a message - ignore
@@ -146,12 +142,16 @@ func (b *Bot) isLastThreadMessageEligible(ctx context.Context, evt *event.Event)
 	if strings.TrimSpace(content.Body) == b.cfg.Get(ctx, config.TextCount.Key) {
 		return false, false
 	}
+	// sent by the bot (auto-close and SLA warnings, etc.), but not a copy of the customer message - ignore
+	if _, ok := evt.Content.Raw["event_id"]; !ok && evt.Sender == b.lp.GetClient().UserID {
+		return false, true
+	}
 	return true, false
 }
 
 // getLastThreadMessage returns the last message in the thread
 func (b *Bot) getLastThreadMessage(ctx context.Context, threadID id.EventID, fromToken ...string) *event.Event {
-	evts, err := b.lp.Relations(ctx, b.roomID, threadID, "m.thread", fromToken...)
+	evts, err := b.lp.Relations(ctx, b.threadRoom(ctx, threadID), threadID, "m.thread", fromToken...)
 	if err != nil {
 		b.log.Error().Err(err).Msg("cannot get thread messages")
 		return nil
@@ -0,0 +1,102 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+func (b *Bot) historyRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	var customer id.UserID
+	var currentThreadID id.EventID
+	if args := b.parseCommand(evt.Content.AsMessage().Body); len(args) > 1 {
+		customer = id.UserID(strings.TrimSpace(args[1]))
+		if _, _, err := customer.Parse(); err != nil {
+			b.SendNotice(ctx, evt.RoomID, "cannot parse MXID `"+customer.String()+"`: "+err.Error(), nil, relatesTo)
+			return
+		}
+	} else {
+		if evt.Content.AsMessage().RelatesTo == nil {
+			b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" history` in a thread, or `"+b.prefix+" history MXID` anywhere", nil, relatesTo)
+			return
+		}
+		threadID, err := b.findThread(evt)
+		if err != nil {
+			b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+			return
+		}
+		ticket, err := b.store.GetTicket(ctx, threadID)
+		if err != nil {
+			b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+			return
+		}
+		customer = ticket.Customer
+		currentThreadID = ticket.ThreadID
+	}
+
+	b.importCustomerThreads(ctx, customer)
+	tickets, err := b.store.ListTicketsByCustomer(ctx, customer)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+
+	var txt strings.Builder
+	var count int
+	for _, ticket := range tickets {
+		if ticket.ThreadID == currentThreadID {
+			continue
+		}
+		count++
+		topic := ticket.Topic
+		if topic == "" {
+			topic = ticket.ThreadID.String()
+		}
+		fmt.Fprintf(&txt, "* [%s](https://matrix.to/#/%s/%s) - `%s`, %s", topic, b.operatorsRoom(ticket), ticket.ThreadID, ticket.State, ticket.CreatedAt.Format(time.DateOnly))
+		if !ticket.ClosedAt.IsZero() {
+			txt.WriteString(" - " + ticket.ClosedAt.Format(time.DateOnly))
+		}
+		if ticket.CSATScore > 0 {
+			txt.WriteString(", rated " + strings.Repeat("⭐", ticket.CSATScore))
+		}
+		if ticket.IssueID != 0 && b.redmine.Enabled() {
+			fmt.Fprintf(&txt, ", [redmine issue #%d](%s/issues/%d)", ticket.IssueID, strings.TrimSuffix(b.redmine.GetHost(), "/"), ticket.IssueID)
+		}
+		txt.WriteString("\n")
+	}
+	if count == 0 {
+		b.SendNotice(ctx, evt.RoomID, customer.String()+" doesn't have previous requests", nil, relatesTo)
+		return
+	}
+
+	b.SendNotice(ctx, evt.RoomID, fmt.Sprintf("%s has %d previous request(s):\n%s", customer, count, txt.String()), nil, relatesTo)
+}
+
+// importCustomerThreads imports threads of the customer missing from the tickets store (e.g. closed before the tickets store was introduced)
+func (b *Bot) importCustomerThreads(ctx context.Context, customer id.UserID) {
+	for _, roomID := range b.getOperatorsRooms(ctx) {
+		var from string
+		for {
+			resp, err := b.lp.Threads(ctx, roomID, from)
+			if err != nil {
+				b.log.Error().Err(err).Str("from", from).Str("roomID", roomID.String()).Msg("cannot request threads for the room")
+				break
+			}
+			for _, evt := range resp.Chunk {
+				if linkpearl.EventContains(evt, "customer", customer.String()) {
+					b.getThreadTicket(ctx, roomID, evt)
+				}
+			}
+			from = resp.NextBatch
+			if from == "" {
+				break
+			}
+		}
+	}
+}
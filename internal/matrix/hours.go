@@ -0,0 +1,65 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/hours"
+	"github.com/etkecc/honoroit/internal/matrix/config"
+)
+
+// offHoursLayout is used to tell customers when the next business hours start
+const offHoursLayout = "Mon, 02 Jan 15:04 MST"
+
+// getSchedule returns the business hours schedule, nil if business hours are not configured
+func (b *Bot) getSchedule(ctx context.Context) *hours.Schedule {
+	weekly := b.cfg.Get(ctx, config.HoursWeekly.Key)
+	holidays := b.cfg.Get(ctx, config.HoursHolidays.Key)
+	if weekly == "" && holidays == "" {
+		return nil
+	}
+	schedule, err := hours.Parse(b.cfg.Get(ctx, config.HoursTimezone.Key), weekly, holidays)
+	if err != nil {
+		b.log.Warn().Err(err).Msg("cannot parse business hours")
+		return nil
+	}
+	return schedule
+}
+
+// elapsed returns the time between from and to, counting only business hours when the toggle option is enabled
+func (b *Bot) elapsed(ctx context.Context, toggle *config.Option, from, to time.Time) time.Duration {
+	if b.cfg.Get(ctx, toggle.Key) == "true" {
+		if schedule := b.getSchedule(ctx); schedule != nil {
+			return schedule.Elapsed(from, to)
+		}
+	}
+	if !to.After(from) {
+		return 0
+	}
+	return to.Sub(from)
+}
+
+// sendOffHours tells the customer when to expect an answer, if the request was sent outside of business hours
+func (b *Bot) sendOffHours(ctx context.Context, roomID id.RoomID) {
+	schedule := b.getSchedule(ctx)
+	if schedule == nil {
+		return
+	}
+	now := time.Now()
+	if schedule.IsOpen(now) {
+		return
+	}
+	nextOpen := schedule.NextOpen(now)
+	if nextOpen.IsZero() {
+		return
+	}
+	text := b.cfg.Get(ctx, config.TextGreetingsOffHours.Key)
+	if strings.Contains(text, "%s") {
+		text = fmt.Sprintf(text, nextOpen.Format(offHoursLayout))
+	}
+	b.SendNotice(ctx, roomID, text, nil)
+}
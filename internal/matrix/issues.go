@@ -2,9 +2,9 @@ package matrix
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/etkecc/go-linkpearl"
 	"github.com/etkecc/go-redmine"
@@ -12,6 +12,9 @@ import (
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/format"
 	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/store"
 )
 
 const issueNotePrefix = "cc.etke.honoroit.redmine.note."
@@ -34,31 +37,21 @@ func (b *Bot) SyncIssues() {
 	b.syncing = true
 	defer func() { b.syncing = false }()
 
-	threadIDs := b.getThreadIDs(ctx)
-	for _, threadID := range threadIDs {
-		b.syncIssue(ctx, threadID)
-	}
-}
-
-func (b *Bot) syncIssue(ctx context.Context, threadID id.EventID) {
-	roomID, err := b.findRoomID(ctx, threadID)
-	if err != nil || roomID == "" {
-		if err != nil && !errors.Is(err, errNotMapped) {
-			b.log.Warn().Err(err).Str("thread_id", threadID.String()).Msg("cannot find room")
-		}
-		return
-	}
-
-	issueIDStr, err := b.getRedmineMapping(ctx, threadID.String())
+	tickets, err := b.store.ListOpenTickets(ctx)
 	if err != nil {
-		if !errors.Is(err, errNotMapped) {
-			b.log.Warn().Err(err).Str("thread_id", threadID.String()).Msg("cannot get redmine mapping")
-		}
-		b.log.Debug().Str("thread_id", threadID.String()).Str("room_id", roomID.String()).Msg("request not mapped")
+		b.log.Error().Err(err).Msg("cannot list open tickets")
 		return
 	}
-	issueID, err := strconv.Atoi(issueIDStr)
-	if err != nil || issueID == 0 {
+	for _, ticket := range tickets {
+		b.syncIssue(ctx, ticket)
+	}
+}
+
+func (b *Bot) syncIssue(ctx context.Context, ticket *store.Ticket) {
+	threadID := ticket.ThreadID
+	roomID := ticket.RoomID
+	issueID := int(ticket.IssueID)
+	if issueID == 0 {
 		b.log.Debug().Str("thread_id", threadID.String()).Str("room_id", roomID.String()).Msg("issue not found")
 		return
 	}
@@ -82,7 +75,7 @@ func (b *Bot) syncIssueStatus(ctx context.Context, threadID id.EventID, issueID
 		Parsed: &content,
 	}
 
-	b.closeRequest(ctx, &event.Event{Content: fullContent}, false)
+	b.closeRequest(ctx, &event.Event{RoomID: b.threadRoom(ctx, threadID), Content: fullContent}, false)
 }
 
 func (b *Bot) syncIssueNotes(ctx context.Context, threadID id.EventID, roomID id.RoomID, issueID int) {
@@ -120,7 +113,8 @@ func (b *Bot) syncIssueNote(ctx context.Context, threadID id.EventID, roomID id.
 	content.MsgType = event.MsgNotice
 	content.RelatesTo = linkpearl.RelatesTo(threadID)
 	b.log.Debug().Str("thread_id", threadID.String()).Int("note_id", int(note.ID)).Msg("sending note to operators room")
-	evtID, err := b.lp.Send(ctx, b.roomID, content)
+	operatorsRoomID := b.threadRoom(ctx, threadID)
+	evtID, err := b.lp.Send(ctx, operatorsRoomID, content)
 	if err != nil {
 		b.log.Error().Err(err).Msg("cannot send note to operators room")
 		return
@@ -140,7 +134,7 @@ func (b *Bot) syncIssueNote(ctx context.Context, threadID id.EventID, roomID id.
 		_, err = b.lp.Send(ctx, roomID, fullContent)
 		if err != nil {
 			b.log.Error().Err(err).Msg("cannot send note to customer room")
-			b.SendNotice(ctx, b.roomID, linkpearl.UnwrapError(err).Error(), nil, linkpearl.RelatesTo(threadID))
+			b.SendNotice(ctx, operatorsRoomID, linkpearl.UnwrapError(err).Error(), nil, linkpearl.RelatesTo(threadID))
 			return
 		}
 	}
@@ -150,6 +144,22 @@ func (b *Bot) syncIssueNote(ctx context.Context, threadID id.EventID, roomID id.
 	}
 }
 
+// skipIssueNotes marks all existing notes of the issue as synced for the thread,
+// used when an existing issue is linked to another thread, to avoid sending old notes to the customer again
+func (b *Bot) skipIssueNotes(ctx context.Context, threadID id.EventID, issueID int64) {
+	notes, err := b.redmine.GetNotes(issueID)
+	if err != nil {
+		b.log.Error().Err(err).Msg("cannot get redmine notes")
+		return
+	}
+	for _, note := range notes {
+		acID := issueNotePrefix + threadID.String() + "_" + strconv.Itoa(int(note.ID))
+		if err := b.lp.SetAccountData(ctx, acID, map[string]string{"synced": "true"}); err != nil {
+			b.log.Error().Err(err).Msg("cannot set account data")
+		}
+	}
+}
+
 // getFileUploadReq returns a redmine.UploadRequest for the given content (if it's a file)
 func (b *Bot) getFileUploadReq(ctx context.Context, content *event.MessageEventContent) *redmine.UploadRequest {
 	var fileEncrypted bool
@@ -201,44 +211,133 @@ func (b *Bot) updateIssue(ctx context.Context, byOperator bool, sender string, t
 	b.mu.Lock(key)
 	defer b.mu.Unlock(key)
 
-	issueIDStr, err := b.getRedmineMapping(ctx, threadID.String())
+	issueID, err := b.findIssueID(ctx, threadID)
 	if err != nil {
 		return
 	}
-	issueID, err := strconv.Atoi(issueIDStr)
-	if err != nil || issueID == 0 {
-		return
-	}
 	var statusID int64
 	var text string
 	if byOperator {
 		statusID = b.redmine.StatusToID(redmine.WaitingForCustomer)
-		text = fmt.Sprintf("_%s (👩‍💼 operator)_\n\n%s", sender, content.Body)
+		text = fmt.Sprintf("_%s (👩‍💼 operator)_\n\n%s", sender, issueText(content))
 	} else {
 		statusID = b.redmine.StatusToID(redmine.WaitingForOperator)
-		text = fmt.Sprintf("_%s (🧑‍🦱customer)_\n\n%s", sender, content.Body)
+		text = fmt.Sprintf("_%s (🧑‍🦱customer)_\n\n%s", sender, issueText(content))
 	}
 
-	if updateErr := b.redmine.UpdateIssue(int64(issueID), statusID, text, b.getFileUploadReq(ctx, content)); updateErr != nil {
+	if updateErr := b.redmine.UpdateIssue(issueID, statusID, text, b.getFileUploadReq(ctx, content)); updateErr != nil {
 		b.log.Error().Err(updateErr).Msg("cannot update redmine issue")
 	}
 }
 
-func (b *Bot) closeIssue(ctx context.Context, roomID id.RoomID, threadID id.EventID, text string) {
+// updateIssueStatus syncs the ticket state changed by the operator to the redmine issue
+func (b *Bot) updateIssueStatus(ctx context.Context, threadID id.EventID, state, text string) {
+	status, ok := stateRedmineStatuses[state]
+	if !ok {
+		return
+	}
 	key := "redmine_" + threadID.String()
 	b.mu.Lock(key)
 	defer b.mu.Unlock(key)
 
-	issueIDStr, err := b.getRedmineMapping(ctx, threadID.String())
+	issueID, err := b.findIssueID(ctx, threadID)
 	if err != nil {
 		return
 	}
-	issueID, err := strconv.Atoi(issueIDStr)
-	if err != nil || issueID == 0 {
+	if updateErr := b.redmine.UpdateIssue(issueID, b.redmine.StatusToID(status), text); updateErr != nil {
+		b.log.Error().Err(updateErr).Msg("cannot update redmine issue status")
+	}
+}
+
+// addIssueNote adds the note (private, if requested) to the redmine issue, issue status is not changed
+func (b *Bot) addIssueNote(ctx context.Context, threadID id.EventID, text string, private bool) {
+	if !b.redmine.Enabled() || b.redmine.GetAPI() == nil {
 		return
 	}
-	log := b.log.With().Int("issue_id", issueID).Logger()
-	issue, err := b.redmine.GetIssue(int64(issueID), "attachments")
+	key := "redmine_" + threadID.String()
+	b.mu.Lock(key)
+	defer b.mu.Unlock(key)
+
+	issueID, err := b.findIssueID(ctx, threadID)
+	if err != nil {
+		return
+	}
+	log := b.log.With().Int64("issue_id", issueID).Logger()
+	update := redminelib.IssueUpdateObject{
+		Notes:        redminelib.StringPtr(text),
+		PrivateNotes: redminelib.BoolPtr(private),
+	}
+	err = redmine.Retry(&log, func() (redminelib.StatusCode, error) {
+		return b.redmine.GetAPI().IssueUpdate(issueID, redminelib.IssueUpdate{Issue: update})
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("cannot add note to redmine issue")
+	}
+}
+
+// updateIssueFields syncs the ticket priority and tags to the redmine issue, if configured
+func (b *Bot) updateIssueFields(ctx context.Context, threadID id.EventID) {
+	if !b.redmine.Enabled() || b.redmine.GetAPI() == nil {
+		return
+	}
+	key := "redmine_" + threadID.String()
+	b.mu.Lock(key)
+	defer b.mu.Unlock(key)
+
+	ticket, err := b.store.GetTicket(ctx, threadID)
+	if err != nil || ticket.IssueID == 0 {
+		return
+	}
+	log := b.log.With().Int64("issue_id", ticket.IssueID).Logger()
+
+	var update redminelib.IssueUpdateObject
+	if priorityID := b.getRedminePriorityID(ctx, ticket.Priority); priorityID != 0 {
+		update.PriorityID = redminelib.Int64Ptr(priorityID)
+	}
+	if fieldID, _ := strconv.Atoi(b.cfg.Get(ctx, config.RedmineTagsField.Key)); fieldID != 0 { //nolint:errcheck // sanitized already
+		tags, err := b.store.GetTags(ctx, threadID)
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot get ticket tags")
+			return
+		}
+		update.CustomFields = &[]redminelib.CustomFieldUpdateObject{{ID: int64(fieldID), Value: tags}}
+	}
+	if update.PriorityID == nil && update.CustomFields == nil {
+		return
+	}
+
+	err = redmine.Retry(&log, func() (redminelib.StatusCode, error) {
+		return b.redmine.GetAPI().IssueUpdate(ticket.IssueID, redminelib.IssueUpdate{Issue: update})
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("cannot update redmine issue priority and tags")
+	}
+}
+
+// getRedminePriorityID returns redmine priority ID of the request priority, 0 if not configured
+func (b *Bot) getRedminePriorityID(ctx context.Context, priority string) int64 {
+	for _, pair := range strings.Split(b.cfg.Get(ctx, config.RedminePriorities.Key), ",") {
+		name, priorityIDStr, ok := strings.Cut(pair, "=")
+		if !ok || name != priority {
+			continue
+		}
+		priorityID, _ := strconv.ParseInt(priorityIDStr, 10, 64) //nolint:errcheck // sanitized already
+		return priorityID
+	}
+	return 0
+}
+
+func (b *Bot) closeIssue(ctx context.Context, threadID id.EventID, text string) {
+	key := "redmine_" + threadID.String()
+	b.mu.Lock(key)
+	defer b.mu.Unlock(key)
+
+	issueID, err := b.findIssueID(ctx, threadID)
+	if err != nil {
+		return
+	}
+	log := b.log.With().Int64("issue_id", issueID).Logger()
+	issue, err := b.redmine.GetIssue(issueID, "attachments")
 	if err != nil {
 		log.Warn().Err(err).Msg("cannot get redmine issue")
 		return
@@ -251,11 +350,7 @@ func (b *Bot) closeIssue(ctx context.Context, roomID id.RoomID, threadID id.Even
 			}
 		}
 	}
-	if updateErr := b.redmine.UpdateIssue(int64(issueID), b.redmine.StatusToID(redmine.Done), text); updateErr != nil {
+	if updateErr := b.redmine.UpdateIssue(issueID, b.redmine.StatusToID(redmine.Done), text); updateErr != nil {
 		log.Warn().Err(updateErr).Msg("cannot close redmine issue")
-		return
 	}
-	b.removeRedmineMapping(ctx, threadID.String())
-	b.removeRedmineMapping(ctx, roomID.String())
-	b.removeRedmineMapping(ctx, issueIDStr)
 }
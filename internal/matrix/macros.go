@@ -0,0 +1,170 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/dustin/go-humanize"
+	"github.com/etkecc/go-linkpearl"
+	"golang.org/x/exp/slices"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/metrics"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// macroNameRegex limits macro names to simple identifiers
+var macroNameRegex = regexp.MustCompile(`^[a-z0-9_.-]+$`)
+
+// macroActions are reserved and cannot be used as macro names
+var macroActions = []string{"save", "list", "delete", "rm", "remove"}
+
+// cutWords returns the first n whitespace-separated words and the rest of the text, with preserved formatting
+func cutWords(text string, n int) (words []string, rest string) {
+	rest = strings.TrimSpace(text)
+	for i := 0; i < n && rest != ""; i++ {
+		idx := strings.IndexFunc(rest, unicode.IsSpace)
+		if idx == -1 {
+			return append(words, rest), ""
+		}
+		words = append(words, rest[:idx])
+		rest = strings.TrimSpace(rest[idx:])
+	}
+	return words, rest
+}
+
+func (b *Bot) macroRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	body := strings.TrimSpace(evt.Content.AsMessage().Body)
+	words, text := cutWords(strings.Replace(body, b.prefix, "", 1), 3)
+	if len(words) < 2 {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" macro NAME`, `"+b.prefix+" macro list`, `"+b.prefix+" macro save NAME TEXT`, `"+b.prefix+" macro delete NAME`", nil, relatesTo)
+		return
+	}
+
+	action := strings.ToLower(words[1])
+	var name string
+	if len(words) > 2 {
+		name = strings.ToLower(words[2])
+	}
+	switch action {
+	case "list":
+		b.listMacros(ctx, evt)
+	case "save":
+		b.saveMacro(ctx, evt, name, text)
+	case "delete", "rm", "remove":
+		b.deleteMacro(ctx, evt, name)
+	default:
+		b.sendMacro(ctx, evt, action)
+	}
+}
+
+func (b *Bot) listMacros(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	macros, err := b.store.ListMacros(ctx)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if len(macros) == 0 {
+		b.SendNotice(ctx, evt.RoomID, "there are no macros yet, use `"+b.prefix+" macro save NAME TEXT` to create one", nil, relatesTo)
+		return
+	}
+
+	var text strings.Builder
+	text.WriteString("Available macros (placeholders: `{customer}`, `{request}`, `{operator}`):\n\n")
+	for _, macro := range macros {
+		preview, _, _ := strings.Cut(macro.Text, "\n")
+		text.WriteString("* `" + macro.Name + "` - " + preview + "\n")
+	}
+	b.SendNotice(ctx, evt.RoomID, text.String(), nil, relatesTo)
+}
+
+func (b *Bot) saveMacro(ctx context.Context, evt *event.Event, name, text string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if name == "" || text == "" {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" macro save NAME TEXT`", nil, relatesTo)
+		return
+	}
+	if !macroNameRegex.MatchString(name) || slices.Contains(macroActions, name) {
+		b.SendNotice(ctx, evt.RoomID, "invalid macro name `"+name+"`, use lowercase letters, numbers, `_`, `.` and `-` only", nil, relatesTo)
+		return
+	}
+
+	if err := b.store.SaveMacro(ctx, &store.Macro{Name: name, Text: text, Author: evt.Sender}); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, "macro `"+name+"` has been saved", nil, relatesTo)
+}
+
+func (b *Bot) deleteMacro(ctx context.Context, evt *event.Event, name string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if name == "" {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" macro delete NAME`", nil, relatesTo)
+		return
+	}
+	if err := b.store.DeleteMacro(ctx, name); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			b.SendNotice(ctx, evt.RoomID, "macro `"+name+"` not found", nil, relatesTo)
+			return
+		}
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, "macro `"+name+"` has been deleted", nil, relatesTo)
+}
+
+// sendMacro renders the macro and sends it to the customer as if the operator wrote it in the thread
+func (b *Bot) sendMacro(ctx context.Context, evt *event.Event, name string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	ticket := b.findThreadTicket(ctx, evt)
+	if ticket == nil {
+		return
+	}
+	macro, err := b.store.GetMacro(ctx, name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			b.SendNotice(ctx, evt.RoomID, "macro `"+name+"` not found, use `"+b.prefix+" macro list` to see available macros", nil, relatesTo)
+			return
+		}
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+
+	text := b.renderMacro(ctx, macro.Text, ticket, evt.Sender)
+	content := format.RenderMarkdown(text, true, true)
+	content.RelatesTo = evt.Content.AsMessage().RelatesTo
+	go metrics.MessagesOperator()
+	b.forwardToCustomer(ctx, evt, &content)
+	b.SendNotice(ctx, evt.RoomID, "macro `"+name+"` has been sent:\n\n"+text, nil, relatesTo)
+}
+
+// renderMacro replaces placeholders in the macro text
+func (b *Bot) renderMacro(ctx context.Context, text string, ticket *store.Ticket, operator id.UserID) string {
+	count, err := b.store.CountCustomerTickets(ctx, ticket.Customer, ticket.CreatedAt)
+	if err != nil || count == 0 {
+		b.log.Warn().Err(err).Str("userID", ticket.Customer.String()).Msg("cannot count customer requests")
+		count = 1
+	}
+
+	return strings.NewReplacer(
+		"{customer}", b.getDisplayName(ctx, ticket.Customer),
+		"{request}", humanize.Ordinal(count),
+		"{operator}", b.getDisplayName(ctx, operator),
+	).Replace(text)
+}
+
+// getDisplayName returns the display name of the user (without MXID), based on the getName
+func (b *Bot) getDisplayName(ctx context.Context, userID id.UserID) string {
+	name, _ := b.getName(ctx, userID)
+	if displayName := strings.TrimSuffix(name, " ("+userID.String()+")"); displayName != "" {
+		return displayName
+	}
+	return userID.String()
+}
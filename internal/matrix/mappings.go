@@ -3,12 +3,17 @@ package matrix
 import (
 	"context"
 	"errors"
+	"strconv"
+	"time"
 
 	"github.com/etkecc/go-linkpearl"
 	"maunium.net/go/mautrix/event"
 	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/store"
 )
 
+// legacy account data prefixes, used only to import mappings into the tickets store
 const (
 	mappingPrefix        = "cc.etke.honoroit.mapping."
 	mappingPrefixRedmine = "cc.etke.honoroit.redmine."
@@ -37,8 +42,9 @@ func (b *Bot) findThread(evt *event.Event) (id.EventID, error) {
 	return threadID, nil
 }
 
-func (b *Bot) getMapping(ctx context.Context, identifier string) (string, error) {
-	data, err := b.lp.GetAccountData(ctx, mappingPrefix+identifier)
+// getLegacyMapping reads room<->thread and thread<->issue mappings from account data
+func (b *Bot) getLegacyMapping(ctx context.Context, prefix, identifier string) (string, error) {
+	data, err := b.lp.GetAccountData(ctx, prefix+identifier)
 	if err != nil {
 		return "", err
 	}
@@ -47,69 +53,144 @@ func (b *Bot) getMapping(ctx context.Context, identifier string) (string, error)
 	}
 
 	v, ok := data["id"]
-	if !ok {
+	if !ok || v == "" {
 		return "", errNotMapped
 	}
 	return v, nil
 }
 
-func (b *Bot) setMapping(ctx context.Context, from, to string) {
-	err := b.lp.SetAccountData(ctx, mappingPrefix+from, map[string]string{"id": to})
-	if err != nil {
-		b.log.Error().Err(err).Msg("cannot set mapping")
+// migrateMappings imports room<->thread and thread<->issue mappings from account data into the tickets store, once
+func (b *Bot) migrateMappings(ctx context.Context) {
+	if !b.roomConfigured || b.cfg.TicketsMigrated(ctx) {
+		return
+	}
+	b.log.Info().Msg("importing account data mappings into the tickets store")
+
+	var imported int
+	var from string
+	for {
+		resp, err := b.lp.Threads(ctx, b.roomID, from)
+		if err != nil {
+			b.log.Error().Err(err).Str("from", from).Msg("cannot request threads for the room, mappings import will be retried on the next start")
+			return
+		}
+		for _, evt := range resp.Chunk {
+			if b.migrateMapping(ctx, evt) {
+				imported++
+			}
+		}
+		from = resp.NextBatch
+		if resp.NextBatch == "" {
+			break
+		}
 	}
-}
 
-func (b *Bot) removeMapping(ctx context.Context, identifier string) {
-	b.lp.SetAccountData(ctx, mappingPrefix+identifier, map[string]string{}) //nolint:errcheck // doesn't matter
+	b.cfg.SetTicketsMigrated(ctx)
+	b.log.Info().Int("tickets", imported).Msg("account data mappings have been imported")
 }
 
-func (b *Bot) getRedmineMapping(ctx context.Context, identifier string) (string, error) {
-	data, err := b.lp.GetAccountData(ctx, mappingPrefixRedmine+identifier)
-	if err != nil {
-		return "", err
+// migrateMapping imports a single thread root as a ticket.
+// Threads without room mapping were closed before the upgrade, so they are imported as done requests
+func (b *Bot) migrateMapping(ctx context.Context, evt *event.Event) bool {
+	if evt.Type == event.EventEncrypted {
+		linkpearl.ParseContent(evt, b.log)
+		decrypted, derr := b.lp.GetClient().Crypto.Decrypt(ctx, evt)
+		if derr == nil {
+			evt = decrypted
+		}
 	}
-	if data == nil {
-		return "", errNotMapped
+	customer := linkpearl.EventField[string](&evt.Content, "customer")
+	if customer == "" {
+		return false
 	}
 
-	v, ok := data["id"]
-	if !ok {
-		return "", errNotMapped
+	createdAt := time.UnixMilli(evt.Timestamp).UTC()
+	ticket := &store.Ticket{
+		ThreadID:   evt.ID,
+		Customer:   id.UserID(customer),
+		Homeserver: linkpearl.EventField[string](&evt.Content, "homeserver"),
+		State:      store.StateOpen,
+		CreatedAt:  createdAt,
+	}
+	roomID, err := b.getLegacyMapping(ctx, mappingPrefix, evt.ID.String())
+	switch {
+	case err == nil:
+		ticket.RoomID = id.RoomID(roomID)
+	case errors.Is(err, errNotMapped):
+		// the exact close time is unknown, so the thread start is used
+		ticket.State = store.StateDone
+		ticket.ClosedAt = createdAt
+	default:
+		b.log.Error().Err(err).Str("threadID", evt.ID.String()).Msg("cannot read room mapping")
+		return false
+	}
+	if issueIDStr, err := b.getLegacyMapping(ctx, mappingPrefixRedmine, evt.ID.String()); err == nil {
+		ticket.IssueID, _ = strconv.ParseInt(issueIDStr, 10, 64) //nolint:errcheck // 0 is fine
 	}
-	return v, nil
-}
 
-func (b *Bot) setRedmineMapping(ctx context.Context, from, to string) {
-	err := b.lp.SetAccountData(ctx, mappingPrefixRedmine+from, map[string]string{"id": to})
-	if err != nil {
-		b.log.Error().Err(err).Msg("cannot set mapping")
+	if err := b.store.AddTicket(ctx, ticket); err != nil {
+		b.log.Error().Err(err).Str("threadID", evt.ID.String()).Str("roomID", roomID).Msg("cannot import mapping")
+		return false
 	}
+	return true
 }
 
-func (b *Bot) removeRedmineMapping(ctx context.Context, identifier string) {
-	b.lp.SetAccountData(ctx, mappingPrefixRedmine+identifier, map[string]string{}) //nolint:errcheck // doesn't matter
+// getTicket by thread ID, only open tickets are returned
+func (b *Bot) getTicket(ctx context.Context, threadID id.EventID) (*store.Ticket, error) {
+	ticket, err := b.store.GetTicket(ctx, threadID)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, errNotMapped
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ticket.IsOpen() {
+		return nil, errNotMapped
+	}
+	return ticket, nil
 }
 
 // findRoomID by eventID
 func (b *Bot) findRoomID(ctx context.Context, eventID id.EventID) (id.RoomID, error) {
-	roomID, err := b.getMapping(ctx, eventID.String())
+	ticket, err := b.getTicket(ctx, eventID)
+	if err != nil {
+		return "", err
+	}
 
-	return id.RoomID(roomID), err
+	return ticket.RoomID, nil
 }
 
 // findEventID by roomID
 func (b *Bot) findEventID(ctx context.Context, roomID id.RoomID) (id.EventID, error) {
-	eventID, err := b.getMapping(ctx, roomID.String())
-	if eventID == "" {
+	ticket, err := b.store.GetOpenTicketByRoom(ctx, roomID)
+	if errors.Is(err, store.ErrNotFound) {
+		return "", errNotMapped
+	}
+	if err != nil {
 		return "", err
 	}
-	_, err = b.lp.GetClient().GetEvent(ctx, b.roomID, id.EventID(eventID))
+	_, err = b.lp.GetClient().GetEvent(ctx, b.operatorsRoom(ticket), ticket.ThreadID)
 	if err != nil {
-		b.removeMapping(ctx, roomID.String())
-		b.removeMapping(ctx, eventID)
+		if derr := b.store.DeleteTicket(ctx, ticket.ThreadID); derr != nil {
+			b.log.Error().Err(derr).Str("threadID", ticket.ThreadID.String()).Msg("cannot remove ticket")
+		}
 		return "", errNotMapped
 	}
 
-	return id.EventID(eventID), nil
+	return ticket.ThreadID, nil
+}
+
+// findIssueID by eventID, regardless of the ticket state
+func (b *Bot) findIssueID(ctx context.Context, eventID id.EventID) (int64, error) {
+	ticket, err := b.store.GetTicket(ctx, eventID)
+	if errors.Is(err, store.ErrNotFound) {
+		return 0, errNotMapped
+	}
+	if err != nil {
+		return 0, err
+	}
+	if ticket.IssueID == 0 {
+		return 0, errNotMapped
+	}
+	return ticket.IssueID, nil
 }
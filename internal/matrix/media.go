@@ -0,0 +1,78 @@
+package matrix
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+)
+
+// asMessage returns the message content of the event, stickers and polls are converted into messages,
+// so they can be forwarded like any other message
+func asMessage(evt *event.Event) *event.MessageEventContent {
+	switch evt.Type {
+	case event.EventSticker:
+		content := evt.Content.AsMessage()
+		if content == nil {
+			return nil
+		}
+		// the copy is sent as a message, so the sticker is rendered as an image
+		content.MsgType = event.MsgImage
+		content.Body = strings.TrimSpace("sticker " + content.Body)
+		return content
+	case event.EventUnstablePollStart:
+		poll, ok := evt.Content.Parsed.(*event.PollStartEventContent)
+		if !ok {
+			return nil
+		}
+		return renderPoll(poll)
+	default:
+		return evt.Content.AsMessage()
+	}
+}
+
+// renderPoll converts the poll into a text message with the question and numbered answers
+func renderPoll(poll *event.PollStartEventContent) *event.MessageEventContent {
+	var txt strings.Builder
+	txt.WriteString("📊 **Poll**: " + poll.PollStart.Question.Text + "\n\n")
+	for i, answer := range poll.PollStart.Answers {
+		fmt.Fprintf(&txt, "%d. %s\n", i+1, answer.Text)
+	}
+	content := format.RenderMarkdown(txt.String(), true, true)
+	content.RelatesTo = poll.RelatesTo
+	return &content
+}
+
+// issueText returns the message text for the redmine issue, with textual fallbacks for non-text messages
+func issueText(content *event.MessageEventContent) string {
+	switch {
+	case content.MsgType == event.MsgLocation:
+		return "📍 location: " + content.Body + "\n\n" + geoURL(content.GeoURI)
+	case content.MSC3245Voice != nil:
+		return "🎤 voice message: " + content.Body
+	default:
+		return content.Body
+	}
+}
+
+// geoURL converts the geo: URI (RFC 5870) into the OpenStreetMap link, the URI is returned as is if it cannot be parsed
+func geoURL(geoURI string) string {
+	coords, _, _ := strings.Cut(strings.TrimPrefix(geoURI, "geo:"), ";")
+	lat, lon, ok := strings.Cut(coords, ",")
+	if !ok || lat == "" || lon == "" {
+		return geoURI
+	}
+	if idx := strings.Index(lon, ","); idx != -1 { // altitude
+		lon = lon[:idx]
+	}
+	if _, err := strconv.ParseFloat(lat, 64); err != nil {
+		return geoURI
+	}
+	if _, err := strconv.ParseFloat(lon, 64); err != nil {
+		return geoURI
+	}
+	return "https://www.openstreetmap.org/?mlat=" + url.QueryEscape(lat) + "&mlon=" + url.QueryEscape(lon)
+}
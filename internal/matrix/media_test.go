@@ -0,0 +1,108 @@
+package matrix
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/suite"
+	"maunium.net/go/mautrix/event"
+)
+
+type mediaSuite struct {
+	suite.Suite
+}
+
+func (s *mediaSuite) TestGeoURL() {
+	tests := []struct {
+		name     string
+		geoURI   string
+		expected string
+	}{
+		{"coordinates", "geo:52.5200,13.4050", "https://www.openstreetmap.org/?mlat=52.5200&mlon=13.4050"},
+		{"negative", "geo:-33.8688,-151.2093", "https://www.openstreetmap.org/?mlat=-33.8688&mlon=-151.2093"},
+		{"altitude", "geo:48.2010,16.3695,183", "https://www.openstreetmap.org/?mlat=48.2010&mlon=16.3695"},
+		{"uncertainty", "geo:48.2010,16.3695;u=35", "https://www.openstreetmap.org/?mlat=48.2010&mlon=16.3695"},
+		{"altitude and parameters", "geo:48.2010,16.3695,183;crs=wgs84;u=35", "https://www.openstreetmap.org/?mlat=48.2010&mlon=16.3695"},
+		{"empty", "", ""},
+		{"no coordinates", "geo:", "geo:"},
+		{"no longitude", "geo:48.2010", "geo:48.2010"},
+		{"empty latitude", "geo:,16.3695", "geo:,16.3695"},
+		{"not a number", "geo:north,east", "geo:north,east"},
+		{"not a geo uri", "https://example.com", "https://example.com"},
+	}
+	for _, test := range tests {
+		s.Run(test.name, func() {
+			s.Equal(test.expected, geoURL(test.geoURI))
+		})
+	}
+}
+
+func (s *mediaSuite) TestRenderPoll() {
+	tests := []struct {
+		name          string
+		poll          string
+		body          []string
+		formattedBody []string
+		threadID      string
+	}{
+		{
+			name:          "answers",
+			poll:          `{"org.matrix.msc3381.poll.start":{"question":{"org.matrix.msc1767.text":"Which plan?"},"answers":[{"id":"1","org.matrix.msc1767.text":"Basic"},{"id":"2","org.matrix.msc1767.text":"Pro"}]}}`,
+			body:          []string{"Poll", "Which plan?", "1. Basic", "2. Pro"},
+			formattedBody: []string{"<strong>Poll</strong>", "<li>Basic</li>", "<li>Pro</li>"},
+		},
+		{
+			name:          "no answers",
+			poll:          `{"org.matrix.msc3381.poll.start":{"question":{"org.matrix.msc1767.text":"Anyone here?"}}}`,
+			body:          []string{"Poll", "Anyone here?"},
+			formattedBody: []string{"<strong>Poll</strong>"},
+		},
+		{
+			name:          "thread",
+			poll:          `{"m.relates_to":{"rel_type":"m.thread","event_id":"$thread"},"org.matrix.msc3381.poll.start":{"question":{"org.matrix.msc1767.text":"Which plan?"},"answers":[{"id":"1","org.matrix.msc1767.text":"Basic"}]}}`,
+			body:          []string{"Which plan?", "1. Basic"},
+			formattedBody: []string{"<li>Basic</li>"},
+			threadID:      "$thread",
+		},
+	}
+	for _, test := range tests {
+		s.Run(test.name, func() {
+			var poll event.PollStartEventContent
+			s.Require().NoError(json.Unmarshal([]byte(test.poll), &poll))
+
+			content := renderPoll(&poll)
+			for _, part := range test.body {
+				s.Contains(content.Body, part)
+			}
+			for _, part := range test.formattedBody {
+				s.Contains(content.FormattedBody, part)
+			}
+			if test.threadID == "" {
+				s.Nil(content.RelatesTo)
+				return
+			}
+			s.Equal(test.threadID, content.RelatesTo.GetThreadParent().String())
+		})
+	}
+}
+
+func (s *mediaSuite) TestIssueText() {
+	tests := []struct {
+		name     string
+		content  *event.MessageEventContent
+		expected string
+	}{
+		{"text", &event.MessageEventContent{MsgType: event.MsgText, Body: "hello"}, "hello"},
+		{"location", &event.MessageEventContent{MsgType: event.MsgLocation, Body: "office", GeoURI: "geo:52.5200,13.4050;u=10"}, "📍 location: office\n\nhttps://www.openstreetmap.org/?mlat=52.5200&mlon=13.4050"},
+		{"voice", &event.MessageEventContent{MsgType: event.MsgAudio, Body: "voice.ogg", MSC3245Voice: &event.MSC3245Voice{}}, "🎤 voice message: voice.ogg"},
+	}
+	for _, test := range tests {
+		s.Run(test.name, func() {
+			s.Equal(test.expected, issueText(test.content))
+		})
+	}
+}
+
+func TestMedia(t *testing.T) {
+	suite.Run(t, new(mediaSuite))
+}
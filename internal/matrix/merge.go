@@ -0,0 +1,94 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// mergeRequest folds the current request into another one: the customer room is remapped to the surviving thread,
+// the current thread is marked as merged and its redmine issue is closed as a duplicate
+func (b *Bot) mergeRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	source := b.findThreadTicket(ctx, evt)
+	if source == nil {
+		return
+	}
+	args := b.parseCommand(evt.Content.AsMessage().Body)
+	if len(args) < 2 {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" merge THREAD_EVENT_ID`", nil, relatesTo)
+		return
+	}
+	targetID := id.EventID(strings.TrimSpace(args[1]))
+	if targetID == source.ThreadID {
+		b.SendNotice(ctx, evt.RoomID, "cannot merge the request into itself", nil, relatesTo)
+		return
+	}
+	target, err := b.getTicket(ctx, targetID)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, "cannot find an open request of the `"+targetID.String()+"` thread: "+linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if target.Customer != source.Customer {
+		b.SendNotice(ctx, evt.RoomID, "cannot merge requests of different customers: "+source.Customer.String()+" and "+target.Customer.String(), nil, relatesTo)
+		return
+	}
+
+	if target.RoomID != source.RoomID {
+		if err := b.store.SetRoomID(ctx, target.ThreadID, source.RoomID); err != nil {
+			b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+			return
+		}
+		b.leaveMergedRoom(ctx, target.RoomID)
+	}
+	if err := b.store.SetMerged(ctx, source.ThreadID, target.ThreadID); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.forgetTypingThread(source.ThreadID)
+	if err := b.updateTopic(ctx, source.ThreadID); err != nil {
+		b.log.Warn().Err(err).Str("threadID", source.ThreadID.String()).Msg("cannot update topic of the merged thread")
+	}
+
+	b.SendNotice(ctx, b.operatorsRoom(source), fmt.Sprintf("this request has been merged into [another one](https://matrix.to/#/%s/%s), please continue there", b.operatorsRoom(target), target.ThreadID), nil, linkpearl.RelatesTo(source.ThreadID))
+	b.SendNotice(ctx, b.operatorsRoom(target), fmt.Sprintf("[another request](https://matrix.to/#/%s/%s) of the customer has been merged into this one by %s", b.operatorsRoom(source), source.ThreadID, evt.Sender), nil, linkpearl.RelatesTo(target.ThreadID))
+
+	go b.mergeIssues(ctx, source, target, evt.Sender)
+}
+
+// leaveMergedRoom tells the customer to continue in another room and leaves the room
+func (b *Bot) leaveMergedRoom(ctx context.Context, roomID id.RoomID) {
+	if b.cfg.Get(ctx, config.Silent.Key) != "true" {
+		b.SendNotice(ctx, roomID, b.cfg.Get(ctx, config.TextMerged.Key), nil)
+	}
+	if _, err := b.lp.GetClient().LeaveRoom(ctx, roomID); err != nil {
+		b.log.Warn().Err(linkpearl.UnwrapError(err)).Str("roomID", roomID.String()).Msg("cannot leave the merged room")
+	}
+}
+
+// mergeIssues relates the redmine issue of the merged request to the surviving one and closes it,
+// if the surviving request has no issue, the issue of the merged request is reused
+func (b *Bot) mergeIssues(ctx context.Context, source, target *store.Ticket, operator id.UserID) {
+	if !b.redmine.Enabled() || source.IssueID == 0 {
+		return
+	}
+	if target.IssueID == 0 {
+		b.skipIssueNotes(ctx, target.ThreadID, source.IssueID)
+		if err := b.store.SetIssueID(ctx, target.ThreadID, source.IssueID); err != nil {
+			b.log.Error().Err(err).Str("threadID", target.ThreadID.String()).Msg("cannot link redmine issue to the surviving request")
+		}
+		return
+	}
+
+	if err := b.redmine.NewIssueRelation(source.IssueID, target.IssueID, "duplicates"); err != nil {
+		b.log.Error().Err(err).Int64("issueID", source.IssueID).Msg("cannot relate redmine issues")
+	}
+	b.updateIssueStatus(ctx, source.ThreadID, store.StateDone, fmt.Sprintf("_%s (👩‍💼 operator) merged the request into #%d_", operator, target.IssueID))
+}
@@ -4,31 +4,34 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/dustin/go-humanize"
 	"github.com/etkecc/go-linkpearl"
 	"maunium.net/go/mautrix/event"
-	"maunium.net/go/mautrix/format"
 	"maunium.net/go/mautrix/id"
 
 	"github.com/etkecc/honoroit/internal/matrix/config"
 	"github.com/etkecc/honoroit/internal/metrics"
+	"github.com/etkecc/honoroit/internal/store"
 )
 
-func (b *Bot) greetings(ctx context.Context, userID id.UserID, roomID id.RoomID) {
+func (b *Bot) greetings(ctx context.Context, userID id.UserID, roomID id.RoomID, queue *store.Queue) {
 	ownServer := userID.Homeserver() == b.lp.GetClient().UserID.Homeserver()
-	if !ownServer {
+	if queue.Greetings != "" {
+		b.SendNotice(ctx, roomID, queue.Greetings, nil)
+	} else if !ownServer {
 		_, requests, err := b.countCustomerRequests(ctx, userID)
 		if err != nil {
 			b.log.Error().Err(err).Str("userID", userID.String()).Msg("cannot calculate count of the support requests")
 		}
 		requestsStr := humanize.Ordinal(requests + 1) // including current request
 		b.SendNotice(ctx, roomID, fmt.Sprintf(b.cfg.Get(ctx, config.TextGreetingsCustomer.Key), requestsStr), nil)
-		return
+	} else {
+		b.SendNotice(ctx, roomID, b.cfg.Get(ctx, config.TextGreetings.Key), nil)
 	}
-	b.SendNotice(ctx, roomID, b.cfg.Get(ctx, config.TextGreetings.Key), nil)
+	b.sendOffHours(ctx, roomID)
 }
 
 func (b *Bot) handle(ctx context.Context, evt *event.Event) {
@@ -37,7 +40,7 @@ func (b *Bot) handle(ctx context.Context, evt *event.Event) {
 		b.log.Warn().Err(err).Msg("cannot send mark event")
 	}
 
-	content := evt.Content.AsMessage()
+	content := asMessage(evt)
 	if content == nil {
 		b.log.Error().Msg("cannot parse the message")
 		return
@@ -48,8 +51,23 @@ func (b *Bot) handle(ctx context.Context, evt *event.Event) {
 		return
 	}
 
+	isOperatorsRoom := b.isOperatorsRoom(ctx, evt.RoomID)
+	if isEdit(content) {
+		b.relayEdit(ctx, evt, content, isOperatorsRoom)
+		return
+	}
+
 	// message sent by client
-	if evt.RoomID != b.roomID {
+	if !isOperatorsRoom {
+		if b.handleSurveyReply(ctx, evt, content) {
+			return
+		}
+		if b.handleCustomerCommand(ctx, evt, content) {
+			return
+		}
+		if b.handleSurveyFollowUp(ctx, evt, content) {
+			return
+		}
 		go metrics.MessagesCustomer(evt.Sender)
 		b.forwardToThread(ctx, evt, content)
 		return
@@ -68,10 +86,11 @@ func (b *Bot) handle(ctx context.Context, evt *event.Event) {
 }
 
 func (b *Bot) replace(ctx context.Context, eventID id.EventID, prefix, suffix, body, formattedBody string) error {
-	evt, err := b.lp.GetClient().GetEvent(ctx, b.roomID, eventID)
+	roomID := b.threadRoom(ctx, eventID)
+	evt, err := b.lp.GetClient().GetEvent(ctx, roomID, eventID)
 	if err != nil {
 		b.log.Error().Err(err).Str("eventID", eventID.String()).Msg("cannot find event to replace")
-		b.SendNotice(ctx, b.roomID, "cannot find event to replace", nil)
+		b.SendNotice(ctx, roomID, "cannot find event to replace", nil)
 		return err
 	}
 
@@ -91,12 +110,16 @@ func (b *Bot) replace(ctx context.Context, eventID id.EventID, prefix, suffix, b
 	content.FormattedBody = formattedBody
 	content.SetEdit(eventID)
 
-	_, err = b.lp.Send(ctx, b.roomID, content)
+	_, err = b.lp.Send(ctx, roomID, content)
 	return err
 }
 
 func (b *Bot) clearPrefix(ctx context.Context, content *event.MessageEventContent) {
-	for _, prefix := range []string{b.cfg.Get(ctx, config.TextPrefixOpen.Key), b.cfg.Get(ctx, config.TextPrefixDone.Key)} {
+	for _, state := range store.States {
+		prefix := b.getStatePrefix(ctx, state)
+		if prefix == "" {
+			continue
+		}
 		index := strings.Index(content.Body, prefix)
 		formattedIndex := strings.Index(content.FormattedBody, prefix)
 		if index > -1 {
@@ -108,7 +131,8 @@ func (b *Bot) clearPrefix(ctx context.Context, content *event.MessageEventConten
 	}
 }
 
-// clearReply removes quotation of previous message in reply message, because it may contain sensitive info
+// clearReply removes quotation of previous message in reply message, because it may contain sensitive info,
+// the reply relation itself is mapped to the mirrored event with mirroredEvent, if possible
 func (b *Bot) clearReply(content *event.MessageEventContent) {
 	index := strings.Index(content.Body, "> <@")
 	formattedIndex := strings.Index(content.FormattedBody, "</mx-reply>")
@@ -124,7 +148,9 @@ func (b *Bot) clearReply(content *event.MessageEventContent) {
 	}
 }
 
-func (b *Bot) startThread(ctx context.Context, roomID id.RoomID, userID id.UserID, greet bool) (id.EventID, error) {
+// startThread returns the thread of the customer room, if there is no open request yet, a new thread is created.
+// The first customer message (body) is used to triage the request and route it to the queue, unless the queue is set explicitly
+func (b *Bot) startThread(ctx context.Context, roomID id.RoomID, userID id.UserID, queue *store.Queue, body string, greet bool) (id.EventID, error) {
 	mukey := "start_thread_" + roomID.String()
 	b.mu.Lock(mukey)
 	defer b.mu.Unlock(mukey)
@@ -143,28 +169,49 @@ func (b *Bot) startThread(ctx context.Context, roomID id.RoomID, userID id.UserI
 		return eventID, nil
 	}
 
+	triage := b.triageRequest(ctx, body)
+	if queue == nil && triage.Queue != "" {
+		if queue, err = b.getQueueByName(ctx, triage.Queue); err != nil {
+			b.log.Warn().Err(err).Str("queue", triage.Queue).Msg("cannot find the triage queue")
+		}
+	}
+	if queue == nil {
+		queue = b.routeRequest(ctx, userID, body)
+	}
+
 	var issueID int64
-	eventID, issueID, err = b.newThread(ctx, b.cfg.Get(ctx, config.TextPrefixOpen.Key), userID)
+	eventID, issueID, err = b.newThread(ctx, queue.RoomID, b.cfg.Get(ctx, config.TextPrefixOpen.Key), userID, triage)
 	if err != nil {
 		return "", err
 	}
 
-	b.setMapping(ctx, roomID.String(), eventID.String())
-	b.setMapping(ctx, eventID.String(), roomID.String())
-	if issueID != 0 {
-		issueIDStr := strconv.Itoa(int(issueID))
-		b.setRedmineMapping(ctx, issueIDStr, eventID.String())
-		b.setRedmineMapping(ctx, eventID.String(), issueIDStr)
-		b.setRedmineMapping(ctx, roomID.String(), issueIDStr)
+	err = b.store.AddTicket(ctx, &store.Ticket{
+		ThreadID:   eventID,
+		RoomID:     roomID,
+		Customer:   userID,
+		Homeserver: userID.Homeserver(),
+		IssueID:    issueID,
+		State:      store.StateOpen,
+
+		OperatorsRoomID: queue.RoomID,
+	})
+	if err != nil {
+		b.log.Error().Err(err).Str("userID", userID.String()).Str("roomID", roomID.String()).Msg("cannot save ticket")
 	}
+	b.applyTriage(ctx, eventID, triage)
+	priority := triage.Priority
+	if priority == "" {
+		priority = store.PriorityNormal
+	}
+	go metrics.RequestNew(priority, triage.Tags)
 
 	if greet && !isSilent {
-		b.greetings(ctx, userID, roomID)
+		b.greetings(ctx, userID, roomID, queue)
 	}
 	return eventID, nil
 }
 
-func (b *Bot) newThread(ctx context.Context, prefix string, userID id.UserID) (id.EventID, int64, error) {
+func (b *Bot) newThread(ctx context.Context, operatorsRoomID id.RoomID, prefix string, userID id.UserID, triage *triageResult) (id.EventID, int64, error) {
 	customerRequests, hsRequests, err := b.countCustomerRequests(ctx, userID)
 	if err != nil {
 		b.log.Error().Err(err).Str("userID", userID.String()).Msg("cannot calculate count of the support requests")
@@ -177,9 +224,13 @@ func (b *Bot) newThread(ctx context.Context, prefix string, userID id.UserID) (i
 	}
 
 	name, _ := b.getName(ctx, userID)
-	eventID := b.SendNotice(ctx, b.roomID, fmt.Sprintf("%s %s request from %s (%s by %s)", prefix, hsRequestsStr, userID.Homeserver(), customerRequestsStr, name), raw)
+	topic := fmt.Sprintf("%s %s request from %s (%s by %s)", prefix, hsRequestsStr, userID.Homeserver(), customerRequestsStr, name)
+	if applied := triage.String(); applied != "" {
+		topic += " (" + applied + ")"
+	}
+	eventID := b.SendNotice(ctx, operatorsRoomID, topic, raw)
 	if eventID == "" {
-		b.SendNotice(ctx, b.roomID, "user "+userID.String()+" tried to send a message, but thread creation failed", nil)
+		b.SendNotice(ctx, operatorsRoomID, "user "+userID.String()+" tried to send a message, but thread creation failed", nil)
 		return "", 0, err
 	}
 
@@ -187,12 +238,16 @@ func (b *Bot) newThread(ctx context.Context, prefix string, userID id.UserID) (i
 	b.mu.Lock(key)
 	defer b.mu.Unlock(key)
 
-	threadURL := fmt.Sprintf("https://matrix.to/#/%s/%s", b.roomID, eventID)
+	threadURL := fmt.Sprintf("https://matrix.to/#/%s/%s", operatorsRoomID, eventID)
+	description := fmt.Sprintf("Matrix thread: [%s](%s)", threadURL, threadURL)
+	if applied := triage.String(); applied != "" {
+		description += "\n\nAuto-triage rules: " + strings.Join(triage.Rules, ", ")
+	}
 	issueID, err := b.redmine.NewIssue(
 		fmt.Sprintf("%s request from %s (%s by %s)", hsRequestsStr, userID.Homeserver(), customerRequestsStr, name),
 		"Matrix",
 		userID.String(),
-		fmt.Sprintf("Matrix thread: [%s](%s)", threadURL, threadURL),
+		description,
 	)
 	if err != nil {
 		b.log.Error().Err(err).Str("userID", userID.String()).Msg("cannot create a new issue in Redmine")
@@ -225,19 +280,30 @@ func (b *Bot) forwardToCustomer(ctx context.Context, evt *event.Event, content *
 		return
 	}
 
+	replyTo := b.mirroredEvent(ctx, threadID, content.RelatesTo.GetNonFallbackReplyTo())
 	content.RelatesTo = nil
 	b.clearReply(content)
+	if replyTo != "" {
+		content.RelatesTo = (&event.RelatesTo{}).SetReplyTo(replyTo)
+	}
+	b.typingThreads.Add(evt.Sender, typingThread{ThreadID: threadID, SentAt: time.Now()})
+	b.humanRequests.Remove(threadID)
 	go b.updateIssue(ctx, true, evt.Sender.String(), threadID, content)
+	go b.indexMessage(ctx, threadID, evt.ID, content.Body, evt.Timestamp)
+	go b.transitionState(ctx, threadID, store.StateOpen, store.StateWaiting)
+	go b.trackFirstResponse(ctx, threadID, time.UnixMilli(evt.Timestamp).UTC())
 	fullContent := &event.Content{
 		Parsed: content,
 		Raw: map[string]any{
 			"event_id": evt.ID,
 		},
 	}
-	_, err = b.lp.Send(ctx, roomID, fullContent)
+	relayID, err := b.lp.Send(ctx, roomID, fullContent)
 	if err != nil {
 		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
 	}
+	b.saveRelay(ctx, event.EventMessage, threadID, evt.ID, relayID, roomID)
 }
 
 func (b *Bot) forwardToThread(ctx context.Context, evt *event.Event, content *event.MessageEventContent) {
@@ -258,35 +324,35 @@ func (b *Bot) forwardToThread(ctx context.Context, evt *event.Event, content *ev
 		return
 	}
 
-	eventID, err := b.startThread(ctx, evt.RoomID, evt.Sender, true)
+	eventID, err := b.startThread(ctx, evt.RoomID, evt.Sender, nil, content.Body, true)
 	if err != nil {
 		if !isSilent {
 			b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextError.Key), nil)
 		}
 		return
 	}
+	// the quote is kept when the replied message has no copy in the thread, otherwise operators lose the context
+	replyTo := b.mirroredEvent(ctx, eventID, content.RelatesTo.GetReplyTo())
+	if replyTo != "" {
+		b.clearReply(content)
+	}
 	originalContent := *content
 	go b.updateIssue(ctx, false, evt.Sender.String(), eventID, &originalContent)
+	go b.indexMessage(ctx, eventID, evt.ID, originalContent.Body, evt.Timestamp)
+	go b.transitionState(ctx, eventID, store.StateWaiting, store.StateOpen)
+	go b.trackFirstMessage(ctx, eventID, time.UnixMilli(evt.Timestamp).UTC())
 
-	bodyMD := content.Body
 	nameMD, nameHTML := b.getName(ctx, evt.Sender)
-	if content.Body != "" {
-		content.Body = nameMD + ":\n" + content.Body
-	}
-	content.Format = event.FormatHTML
-	if content.FormattedBody != "" {
-		content.FormattedBody = nameHTML + ":<br>" + content.FormattedBody
-	} else {
-		var formattedBody string
-		formatted := format.RenderMarkdown(bodyMD, true, true)
-		if formatted.FormattedBody == "" {
-			formattedBody = nameHTML + ":<br>" + bodyMD
-		} else {
-			formattedBody = nameHTML + ":<br>" + formatted.FormattedBody
-		}
-		content.FormattedBody = formattedBody
+	if ticket, terr := b.getTicket(ctx, eventID); terr == nil && ticket.Assignee != "" {
+		nameMD += " (cc " + ticket.Assignee.String() + ")"
+		nameHTML += fmt.Sprintf(" (cc <a href=\"https://matrix.to/#/%s\">%s</a>)", ticket.Assignee, ticket.Assignee)
+		content.Mentions = &event.Mentions{UserIDs: []id.UserID{ticket.Assignee}}
 	}
+	withSenderName(content, nameMD, nameHTML)
 	content.RelatesTo = linkpearl.RelatesTo(eventID)
+	if replyTo != "" {
+		content.RelatesTo.SetReplyTo(replyTo)
+	}
 
 	fullContent := &event.Content{
 		Parsed: content,
@@ -298,11 +364,14 @@ func (b *Bot) forwardToThread(ctx context.Context, evt *event.Event, content *ev
 		fullContent.Raw["com.beeper.per_message_profile"] = profile
 	}
 
-	_, err = b.lp.Send(ctx, b.roomID, fullContent)
+	operatorsRoomID := b.threadRoom(ctx, eventID)
+	relayID, err := b.lp.Send(ctx, operatorsRoomID, fullContent)
 	if err != nil {
 		b.log.Error().Err(err).Str("userID", evt.Sender.String()).Str("roomID", evt.RoomID.String()).Msg("user tried to send a message, but creation of the thread failed")
 		if !isSilent {
 			b.SendNotice(ctx, evt.RoomID, b.cfg.Get(ctx, config.TextError.Key), nil)
 		}
+		return
 	}
+	b.saveRelay(ctx, event.EventMessage, eventID, evt.ID, relayID, operatorsRoomID)
 }
@@ -0,0 +1,161 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// moveSummaryMessages is the amount of the last conversation messages included into the moved request summary
+const moveSummaryMessages = 5
+
+// moveRequest hands the request off to another queue: a new thread is created in the queue room,
+// the customer room and the redmine issue are remapped to it, and the current thread is closed
+func (b *Bot) moveRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	source := b.findThreadTicket(ctx, evt)
+	if source == nil {
+		return
+	}
+	args := b.parseCommand(evt.Content.AsMessage().Body)
+	if len(args) < 2 {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" move QUEUE`, use `"+b.prefix+" queue list` to see available queues", nil, relatesTo)
+		return
+	}
+	queue, err := b.getQueueByName(ctx, strings.ToLower(strings.TrimSpace(args[1])))
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if queue.RoomID == b.operatorsRoom(source) {
+		b.SendNotice(ctx, evt.RoomID, "the request is already in the `"+queue.Name+"` queue", nil, relatesTo)
+		return
+	}
+
+	key := "start_thread_" + source.RoomID.String()
+	b.mu.Lock(key)
+	defer b.mu.Unlock(key)
+
+	threadID, err := b.moveTicket(ctx, source, queue, evt.Sender)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, b.operatorsRoom(source), fmt.Sprintf("this request has been moved to the `%s` queue, [continue there](https://matrix.to/#/%s/%s)", queue.Name, queue.RoomID, threadID), nil, linkpearl.RelatesTo(source.ThreadID))
+
+	if source.IssueID != 0 {
+		threadURL := fmt.Sprintf("https://matrix.to/#/%s/%s", queue.RoomID, threadID)
+		go b.updateIssueStatus(ctx, threadID, store.StateOpen, fmt.Sprintf("_%s (👩‍💼 operator) moved the request to the %s queue_\n\nMatrix thread: [%s](%s)", evt.Sender, queue.Name, threadURL, threadURL))
+	}
+}
+
+// getQueueByName returns the queue by name, including the default one
+func (b *Bot) getQueueByName(ctx context.Context, name string) (*store.Queue, error) {
+	if name == defaultQueueName {
+		return &store.Queue{Name: defaultQueueName, RoomID: b.roomID}, nil
+	}
+	queue, err := b.store.GetQueue(ctx, name)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("queue `%s` not found, use `%s queue list` to see available queues", name, b.prefix)
+	}
+	return queue, err
+}
+
+// moveTicket creates a new thread with the request summary in the queue room and moves the ticket there,
+// returns the new thread ID
+func (b *Bot) moveTicket(ctx context.Context, source *store.Ticket, queue *store.Queue, operator id.UserID) (id.EventID, error) {
+	topic := source.Topic
+	if topic == "" {
+		topic, _, _ = b.getTopic(ctx, source.ThreadID) //nolint:errcheck // topic is optional
+	}
+	threadID := b.SendNotice(ctx, queue.RoomID, b.cfg.Get(ctx, config.TextPrefixOpen.Key)+" "+topic, nil)
+	if threadID == "" {
+		return "", errors.New("cannot create a new thread in the `" + queue.Name + "` queue")
+	}
+
+	target := &store.Ticket{
+		ThreadID:        threadID,
+		RoomID:          source.RoomID,
+		Customer:        source.Customer,
+		Homeserver:      source.Homeserver,
+		IssueID:         source.IssueID,
+		State:           store.StateOpen,
+		CreatedAt:       source.CreatedAt,
+		Topic:           topic,
+		TopicHTML:       source.TopicHTML,
+		Priority:        source.Priority,
+		FirstMessageAt:  source.FirstMessageAt,
+		FirstResponseAt: source.FirstResponseAt,
+		OperatorsRoomID: queue.RoomID,
+	}
+	if err := b.store.AddTicket(ctx, target); err != nil {
+		return "", err
+	}
+	tags, err := b.store.GetTags(ctx, source.ThreadID)
+	if err != nil {
+		b.log.Warn().Err(err).Str("threadID", source.ThreadID.String()).Msg("cannot get ticket tags")
+	}
+	for _, tag := range tags {
+		if err := b.store.AddTag(ctx, threadID, tag); err != nil {
+			b.log.Warn().Err(err).Str("threadID", threadID.String()).Str("tag", tag).Msg("cannot copy ticket tag")
+		}
+	}
+	if target.IssueID != 0 && b.redmine.Enabled() {
+		b.skipIssueNotes(ctx, threadID, target.IssueID)
+	}
+	if err := b.store.SetMoved(ctx, source.ThreadID, threadID); err != nil {
+		return "", err
+	}
+	b.forgetTypingThread(source.ThreadID)
+
+	if err := b.updateTopic(ctx, threadID); err != nil {
+		b.log.Warn().Err(err).Str("threadID", threadID.String()).Msg("cannot update topic of the moved thread")
+	}
+	if err := b.updateTopic(ctx, source.ThreadID); err != nil {
+		b.log.Warn().Err(err).Str("threadID", source.ThreadID.String()).Msg("cannot update topic of the source thread")
+	}
+	b.SendNotice(ctx, queue.RoomID, b.getMoveSummary(ctx, source, operator), nil, linkpearl.RelatesTo(threadID))
+	return threadID, nil
+}
+
+// getMoveSummary describes the moved request and quotes the last messages of the conversation
+func (b *Bot) getMoveSummary(ctx context.Context, source *store.Ticket, operator id.UserID) string {
+	var txt strings.Builder
+	fmt.Fprintf(&txt, "%s moved the request from [another queue](https://matrix.to/#/%s/%s)\n\n", operator, b.operatorsRoom(source), source.ThreadID)
+	fmt.Fprintf(&txt, "* Customer: %s\n", source.Customer)
+	fmt.Fprintf(&txt, "* Created: %s\n", source.CreatedAt.Format(time.DateOnly))
+	fmt.Fprintf(&txt, "* Status: `%s`, priority: `%s`\n", source.State, source.Priority)
+	if source.Assignee != "" {
+		fmt.Fprintf(&txt, "* Previous assignee: %s\n", source.Assignee)
+	}
+	if source.IssueID != 0 && b.redmine.Enabled() {
+		fmt.Fprintf(&txt, "* Redmine: %s/issues/%d\n", b.redmine.GetHost(), source.IssueID)
+	}
+
+	transcript, err := b.getTranscript(ctx, source, true)
+	if err != nil {
+		b.log.Warn().Err(err).Str("threadID", source.ThreadID.String()).Msg("cannot get transcript of the moved request")
+		return txt.String()
+	}
+	messages := transcript.Messages
+	if len(messages) > moveSummaryMessages {
+		messages = messages[len(messages)-moveSummaryMessages:]
+	}
+	if len(messages) > 0 {
+		txt.WriteString("\nLast messages:\n\n")
+	}
+	for _, msg := range messages {
+		body := strings.ReplaceAll(strings.TrimSpace(msg.Body), "\n", "\n> ")
+		fmt.Fprintf(&txt, "> **%s** (%s):\n> %s\n\n", msg.SenderName, msg.Header(), body)
+	}
+	return txt.String()
+}
@@ -0,0 +1,47 @@
+package matrix
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// noteRequest stores the internal note of the thread and pushes it to the redmine issue as a private note,
+// notes sent outside of threads are ignored, as before
+func (b *Bot) noteRequest(ctx context.Context, evt *event.Event) {
+	content := evt.Content.AsMessage()
+	_, text := cutWords(strings.Replace(content.Body, b.prefix, "", 1), 1)
+	if text == "" || content.RelatesTo == nil {
+		return
+	}
+	threadID, err := b.findThread(evt)
+	if err != nil {
+		return
+	}
+	ticket, err := b.store.GetTicket(ctx, threadID)
+	if err != nil {
+		b.log.Debug().Err(err).Str("threadID", threadID.String()).Msg("cannot find request of the note")
+		return
+	}
+
+	note := &store.Note{
+		EventID:   evt.ID,
+		ThreadID:  ticket.ThreadID,
+		Author:    evt.Sender,
+		Body:      text,
+		CreatedAt: time.UnixMilli(evt.Timestamp).UTC(),
+	}
+	if err := b.store.AddNote(ctx, note); err != nil {
+		b.log.Error().Err(err).Str("threadID", threadID.String()).Msg("cannot save note")
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, linkpearl.EventRelatesTo(evt))
+		return
+	}
+	go b.indexMessage(ctx, ticket.ThreadID, evt.ID, text, evt.Timestamp)
+	go b.addIssueNote(ctx, ticket.ThreadID, fmt.Sprintf("_%s (👩‍💼 operator, internal note)_\n\n%s", note.Author, note.Body), true)
+}
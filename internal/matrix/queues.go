@@ -0,0 +1,364 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/etkecc/go-linkpearl"
+	"github.com/etkecc/go-mxidwc"
+	"golang.org/x/exp/slices"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/metrics"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// defaultQueueName is the name of the main operators room (HONOROIT_ROOMID)
+const defaultQueueName = "default"
+
+// queueNameRegex limits queue names to simple identifiers
+var queueNameRegex = regexp.MustCompile(`^[a-z0-9_.-]+$`)
+
+// queueActions are reserved and cannot be used as queue names
+var queueActions = []string{defaultQueueName, "list", "add", "rules", "greetings", "receipts", "delete", "rm", "remove"}
+
+// queueRuleTypes are supported routing rule types
+var queueRuleTypes = []string{"user", "homeserver", "source", "keyword"}
+
+// parseQueueRule validates the routing rule in the TYPE:VALUE format
+func parseQueueRule(rule string) (ruleType, value string, err error) {
+	ruleType, value, ok := strings.Cut(strings.TrimSpace(rule), ":")
+	ruleType = strings.ToLower(strings.TrimSpace(ruleType))
+	value = strings.TrimSpace(value)
+	if !ok || value == "" || !slices.Contains(queueRuleTypes, ruleType) {
+		return "", "", fmt.Errorf("invalid rule %q, expected TYPE:VALUE, where TYPE is one of: %s", rule, strings.Join(queueRuleTypes, ", "))
+	}
+	if ruleType == "user" {
+		if _, err := mxidwc.ParsePattern(value); err != nil {
+			return "", "", fmt.Errorf("invalid rule %q: %w", rule, err)
+		}
+	}
+	return ruleType, value, nil
+}
+
+// matchQueueRule checks if the customer and their first message match the routing rule
+func matchQueueRule(rule string, userID id.UserID, body string) bool {
+	ruleType, value, err := parseQueueRule(rule)
+	if err != nil {
+		return false
+	}
+	switch ruleType {
+	case "user":
+		pattern, err := mxidwc.ParsePattern(value)
+		if err != nil {
+			return false
+		}
+		return mxidwc.Match(userID.String(), []*regexp.Regexp{pattern})
+	case "homeserver":
+		return strings.EqualFold(userID.Homeserver(), value)
+	case "source":
+		return strings.EqualFold(metrics.GetSource(userID), value)
+	case "keyword":
+		return strings.Contains(strings.ToLower(body), strings.ToLower(value))
+	default:
+		return false
+	}
+}
+
+// getDefaultQueue returns the queue for requests that don't match any routing rule
+func (b *Bot) getDefaultQueue(ctx context.Context) *store.Queue {
+	if name := b.cfg.Get(ctx, config.QueueDefault.Key); name != "" && name != defaultQueueName {
+		queue, err := b.store.GetQueue(ctx, name)
+		if err == nil {
+			return queue
+		}
+		b.log.Warn().Err(err).Str("queue", name).Msg("cannot find the default queue, using the main operators room")
+	}
+	return &store.Queue{Name: defaultQueueName, RoomID: b.roomID}
+}
+
+// routeRequest returns the queue of a new request: the first queue with a matching routing rule or the default one
+func (b *Bot) routeRequest(ctx context.Context, userID id.UserID, body string) *store.Queue {
+	queues, err := b.store.ListQueues(ctx)
+	if err != nil {
+		b.log.Error().Err(err).Msg("cannot list queues")
+		return b.getDefaultQueue(ctx)
+	}
+	for _, queue := range queues {
+		for _, rule := range queue.Rules {
+			if matchQueueRule(rule, userID, body) {
+				return queue
+			}
+		}
+	}
+	return b.getDefaultQueue(ctx)
+}
+
+// getQueueByRoom returns the queue of the operators room
+func (b *Bot) getQueueByRoom(ctx context.Context, roomID id.RoomID) *store.Queue {
+	if queue, err := b.store.GetQueueByRoom(ctx, roomID); err == nil {
+		return queue
+	}
+	return &store.Queue{Name: defaultQueueName, RoomID: b.roomID}
+}
+
+// isOperatorsRoom returns true if the room is the main operators room or a queue room
+func (b *Bot) isOperatorsRoom(ctx context.Context, roomID id.RoomID) bool {
+	if roomID == b.roomID {
+		return true
+	}
+	_, err := b.store.GetQueueByRoom(ctx, roomID)
+	return err == nil
+}
+
+// getOperatorsRooms returns the main operators room and all queue rooms
+func (b *Bot) getOperatorsRooms(ctx context.Context) []id.RoomID {
+	rooms := []id.RoomID{b.roomID}
+	queues, err := b.store.ListQueues(ctx)
+	if err != nil {
+		b.log.Error().Err(err).Msg("cannot list queues")
+		return rooms
+	}
+	for _, queue := range queues {
+		rooms = append(rooms, queue.RoomID)
+	}
+	return rooms
+}
+
+// operatorsRoom returns the operators room of the ticket thread
+func (b *Bot) operatorsRoom(ticket *store.Ticket) id.RoomID {
+	if ticket.OperatorsRoomID == "" { // tickets created before queues
+		return b.roomID
+	}
+	return ticket.OperatorsRoomID
+}
+
+// threadRoom returns the operators room of the thread, regardless of the ticket state
+func (b *Bot) threadRoom(ctx context.Context, threadID id.EventID) id.RoomID {
+	ticket, err := b.store.GetTicket(ctx, threadID)
+	if err != nil {
+		return b.roomID
+	}
+	return b.operatorsRoom(ticket)
+}
+
+func (b *Bot) queueRequest(ctx context.Context, evt *event.Event) {
+	body := strings.TrimSpace(evt.Content.AsMessage().Body)
+	words, rest := cutWords(strings.Replace(body, b.prefix, "", 1), 3)
+	var action, name string
+	if len(words) > 1 {
+		action = strings.ToLower(words[1])
+	}
+	if len(words) > 2 {
+		name = strings.ToLower(words[2])
+	}
+
+	switch action {
+	case "", "list":
+		b.listQueues(ctx, evt)
+	case "add":
+		b.addQueue(ctx, evt, name, id.RoomID(rest))
+	case "rules":
+		b.setQueueRules(ctx, evt, name, rest)
+	case "greetings":
+		b.setQueueGreetings(ctx, evt, name, rest)
+	case "receipts":
+		b.setQueueReceipts(ctx, evt, name, rest)
+	case "delete", "rm", "remove":
+		b.deleteQueue(ctx, evt, name)
+	default:
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" queue list`, `"+b.prefix+" queue add NAME ROOM_ID`, `"+b.prefix+" queue rules NAME RULES`, `"+b.prefix+" queue greetings NAME TEXT`, `"+b.prefix+" queue receipts NAME REACTION`, `"+b.prefix+" queue delete NAME`", nil, linkpearl.EventRelatesTo(evt))
+	}
+}
+
+func (b *Bot) listQueues(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	queues, err := b.store.ListQueues(ctx)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	defaultQueue := b.getDefaultQueue(ctx)
+
+	var txt strings.Builder
+	txt.WriteString("Queues, in the order of routing rules evaluation:\n\n")
+	for _, queue := range queues {
+		fmt.Fprintf(&txt, "* `%s` - %s", queue.Name, queue.RoomID)
+		if queue.Name == defaultQueue.Name {
+			txt.WriteString(" (default)")
+		}
+		if len(queue.Rules) > 0 {
+			txt.WriteString(", rules: `" + strings.Join(queue.Rules, "`, `") + "`")
+		}
+		if queue.Greetings != "" {
+			txt.WriteString(", custom greetings")
+		}
+		if queue.Receipts != "" {
+			txt.WriteString(", read receipts: `" + queue.Receipts + "`")
+		}
+		txt.WriteString("\n")
+	}
+	fmt.Fprintf(&txt, "* `%s` - %s", defaultQueueName, b.roomID)
+	if defaultQueue.Name == defaultQueueName {
+		txt.WriteString(" (default)")
+	}
+	txt.WriteString("\n")
+	b.SendNotice(ctx, evt.RoomID, txt.String(), nil, relatesTo)
+}
+
+func (b *Bot) addQueue(ctx context.Context, evt *event.Event, name string, roomID id.RoomID) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if name == "" || roomID == "" {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" queue add NAME ROOM_ID`", nil, relatesTo)
+		return
+	}
+	if !queueNameRegex.MatchString(name) || slices.Contains(queueActions, name) {
+		b.SendNotice(ctx, evt.RoomID, "invalid queue name `"+name+"`, use lowercase letters, numbers, `_`, `.` and `-` only", nil, relatesTo)
+		return
+	}
+	if _, err := b.store.GetQueue(ctx, name); err == nil {
+		b.SendNotice(ctx, evt.RoomID, "queue `"+name+"` already exists", nil, relatesTo)
+		return
+	}
+	if b.isOperatorsRoom(ctx, roomID) {
+		b.SendNotice(ctx, evt.RoomID, "the room is already used as an operators room", nil, relatesTo)
+		return
+	}
+	if _, err := b.store.GetOpenTicketByRoom(ctx, roomID); err == nil {
+		b.SendNotice(ctx, evt.RoomID, "the room is a customer room", nil, relatesTo)
+		return
+	}
+	if _, err := b.lp.GetClient().JoinRoomByID(ctx, roomID); err != nil {
+		b.SendNotice(ctx, evt.RoomID, "cannot join the room, invite the bot first: "+linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+
+	if err := b.store.SaveQueue(ctx, &store.Queue{Name: name, RoomID: roomID}); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, "queue `"+name+"` has been added, use `"+b.prefix+" queue rules "+name+" RULES` to route requests into it", nil, relatesTo)
+}
+
+func (b *Bot) setQueueRules(ctx context.Context, evt *event.Event, name, rulesStr string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	queue := b.findQueue(ctx, evt, name)
+	if queue == nil {
+		return
+	}
+
+	rules := []string{}
+	for _, rule := range strings.Split(rulesStr, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+		ruleType, value, err := parseQueueRule(rule)
+		if err != nil {
+			b.SendNotice(ctx, evt.RoomID, err.Error(), nil, relatesTo)
+			return
+		}
+		rules = append(rules, ruleType+":"+value)
+	}
+	queue.Rules = rules
+	if err := b.store.SaveQueue(ctx, queue); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if len(rules) == 0 {
+		b.SendNotice(ctx, evt.RoomID, "routing rules of the `"+name+"` queue have been removed", nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, "routing rules of the `"+name+"` queue have been updated: `"+strings.Join(rules, "`, `")+"`", nil, relatesTo)
+}
+
+func (b *Bot) setQueueGreetings(ctx context.Context, evt *event.Event, name, text string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	queue := b.findQueue(ctx, evt, name)
+	if queue == nil {
+		return
+	}
+
+	queue.Greetings = text
+	if err := b.store.SaveQueue(ctx, queue); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if text == "" {
+		b.SendNotice(ctx, evt.RoomID, "the `"+name+"` queue will use the default greetings", nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, "greetings of the `"+name+"` queue have been updated", nil, relatesTo)
+}
+
+func (b *Bot) setQueueReceipts(ctx context.Context, evt *event.Event, name, reaction string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	queue := b.findQueue(ctx, evt, name)
+	if queue == nil {
+		return
+	}
+
+	queue.Receipts = config.ReceiptsReaction.Sanitizer(reaction)
+	if err := b.store.SaveQueue(ctx, queue); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	switch queue.Receipts {
+	case "":
+		b.SendNotice(ctx, evt.RoomID, "the `"+name+"` queue will use the default read receipts reaction (the `"+config.ReceiptsReaction.Key+"` config option)", nil, relatesTo)
+	case receiptsOff:
+		b.SendNotice(ctx, evt.RoomID, "read receipts of the `"+name+"` queue have been disabled", nil, relatesTo)
+	default:
+		b.SendNotice(ctx, evt.RoomID, "read receipts of the `"+name+"` queue will be shown with the "+queue.Receipts+" reaction", nil, relatesTo)
+	}
+}
+
+func (b *Bot) deleteQueue(ctx context.Context, evt *event.Event, name string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	queue := b.findQueue(ctx, evt, name)
+	if queue == nil {
+		return
+	}
+	tickets, err := b.store.ListOpenTicketsByOperatorsRoom(ctx, queue.RoomID)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if len(tickets) > 0 {
+		b.SendNotice(ctx, evt.RoomID, fmt.Sprintf("the `%s` queue has %d open requests, close or move them first", name, len(tickets)), nil, relatesTo)
+		return
+	}
+
+	if err := b.store.DeleteQueue(ctx, name); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, "queue `"+name+"` has been deleted", nil, relatesTo)
+}
+
+// findQueue returns the queue by name, sends a notice if there is no such queue
+func (b *Bot) findQueue(ctx context.Context, evt *event.Event, name string) *store.Queue {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if name == "" {
+		b.SendNotice(ctx, evt.RoomID, "queue name is not specified", nil, relatesTo)
+		return nil
+	}
+	if name == defaultQueueName {
+		b.SendNotice(ctx, evt.RoomID, "the `"+defaultQueueName+"` queue is the main operators room, it's configured with the `HONOROIT_ROOMID` env var and `"+b.prefix+" config` options", nil, relatesTo)
+		return nil
+	}
+	queue, err := b.store.GetQueue(ctx, name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			b.SendNotice(ctx, evt.RoomID, "queue `"+name+"` not found, use `"+b.prefix+" queue list` to see available queues", nil, relatesTo)
+			return nil
+		}
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return nil
+	}
+	return queue
+}
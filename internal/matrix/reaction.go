@@ -12,7 +12,7 @@ func (b *Bot) forwardReaction(ctx context.Context, evt *event.Event) {
 	b.mu.Lock(evt.RoomID.String())
 	defer b.mu.Unlock(evt.RoomID.String())
 
-	if evt.RoomID == b.roomID {
+	if b.isOperatorsRoom(ctx, evt.RoomID) {
 		b.forwardReactionToCustomer(ctx, evt)
 		return
 	}
@@ -55,10 +55,12 @@ func (b *Bot) forwardReactionToCustomer(ctx context.Context, evt *event.Event) {
 		targetID = targetEvent.ID.String()
 	}
 
-	_, err = b.lp.GetClient().SendReaction(ctx, roomID, id.EventID(targetID), content.RelatesTo.Key)
+	resp, err := b.lp.GetClient().SendReaction(ctx, roomID, id.EventID(targetID), content.RelatesTo.Key)
 	if err != nil {
 		b.log.Error().Err(err).Str("sourceID", sourceID.String()).Msg("cannot send reaction")
+		return
 	}
+	b.saveRelay(ctx, event.EventReaction, parentID, evt.ID, resp.EventID, roomID)
 }
 
 func (b *Bot) forwardReactionToThread(ctx context.Context, evt *event.Event) {
@@ -86,8 +88,16 @@ func (b *Bot) forwardReactionToThread(ctx context.Context, evt *event.Event) {
 		return
 	}
 
-	_, err = b.lp.GetClient().SendReaction(ctx, b.roomID, id.EventID(operatorsRoomEventID), content.RelatesTo.Key)
+	operatorsRoomID := b.roomID
+	var threadID id.EventID
+	if ticket, terr := b.store.GetOpenTicketByRoom(ctx, evt.RoomID); terr == nil {
+		operatorsRoomID = b.operatorsRoom(ticket)
+		threadID = ticket.ThreadID
+	}
+	resp, err := b.lp.GetClient().SendReaction(ctx, operatorsRoomID, id.EventID(operatorsRoomEventID), content.RelatesTo.Key)
 	if err != nil {
 		b.log.Error().Err(err).Msg("cannot send reaction")
+		return
 	}
+	b.saveRelay(ctx, event.EventReaction, threadID, evt.ID, resp.EventID, operatorsRoomID)
 }
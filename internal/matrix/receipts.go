@@ -0,0 +1,81 @@
+package matrix
+
+import (
+	"context"
+	"time"
+
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+)
+
+// receiptsOff disables read receipts relay
+const receiptsOff = "off"
+
+// forwardReceipt reflects read receipts of the customer in the thread, as reactions on the operator messages
+func (b *Bot) forwardReceipt(ctx context.Context, evt *event.Event) {
+	if b.isOperatorsRoom(ctx, evt.RoomID) {
+		return
+	}
+	ticket, err := b.store.GetOpenTicketByRoom(ctx, evt.RoomID)
+	if err != nil {
+		return
+	}
+	content := evt.Content.AsReceipt()
+	for eventID, receipts := range *content {
+		// only the customer of the request, other room members (e.g. bridge bots) are ignored
+		if _, ok := receipts[event.ReceiptTypeRead][ticket.Customer]; ok {
+			b.markRelaysRead(ctx, evt.RoomID, eventID)
+		}
+	}
+}
+
+// markRelaysRead marks operator messages in the customer room, sent before (and including) the read event, as read
+func (b *Bot) markRelaysRead(ctx context.Context, roomID id.RoomID, eventID id.EventID) {
+	key := "receipts_" + roomID.String()
+	b.mu.Lock(key)
+	defer b.mu.Unlock(key)
+
+	log := b.log.With().Str("roomID", roomID.String()).Str("eventID", eventID.String()).Logger()
+	var readAt time.Time
+	if relay, err := b.store.GetRelayByCopy(ctx, eventID); err == nil {
+		readAt = relay.CreatedAt
+	} else {
+		evt, err := b.lp.GetClient().GetEvent(ctx, roomID, eventID)
+		if err != nil {
+			log.Warn().Err(err).Msg("cannot get the read event")
+			return
+		}
+		readAt = time.UnixMilli(evt.Timestamp).UTC()
+	}
+
+	relays, err := b.store.ListUnreadRelays(ctx, roomID, readAt)
+	if err != nil {
+		log.Error().Err(err).Msg("cannot list unread messages")
+		return
+	}
+	for _, relay := range relays {
+		updated, err := b.store.SetRelayRead(ctx, relay.EventID)
+		if err != nil {
+			log.Error().Err(err).Str("relayID", relay.RelayID.String()).Msg("cannot mark the message as read")
+			continue
+		}
+		operatorsRoomID := b.threadRoom(ctx, relay.ThreadID)
+		reaction := b.getReceiptsReaction(ctx, operatorsRoomID)
+		if !updated || reaction == receiptsOff {
+			continue
+		}
+		if _, err := b.lp.GetClient().SendReaction(ctx, operatorsRoomID, relay.EventID, reaction); err != nil {
+			log.Error().Err(err).Str("relayID", relay.RelayID.String()).Msg("cannot send read receipt reaction")
+		}
+	}
+}
+
+// getReceiptsReaction returns read receipts reaction of the operators room (queue), "off" means read receipts are disabled
+func (b *Bot) getReceiptsReaction(ctx context.Context, operatorsRoomID id.RoomID) string {
+	if queue := b.getQueueByRoom(ctx, operatorsRoomID); queue.Receipts != "" {
+		return queue.Receipts
+	}
+	return b.cfg.Get(ctx, config.ReceiptsReaction.Key)
+}
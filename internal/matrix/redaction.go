@@ -0,0 +1,108 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// forwardRedaction redacts the copy of the redacted event in the other room (customer room or thread)
+func (b *Bot) forwardRedaction(ctx context.Context, evt *event.Event) {
+	linkpearl.ParseContent(evt, b.log)
+	redacts := evt.Redacts
+	if redacts == "" {
+		if content := evt.Content.AsRedaction(); content != nil {
+			redacts = content.Redacts
+		}
+	}
+	if redacts == "" {
+		return
+	}
+	log := b.log.With().Str("eventID", redacts.String()).Str("roomID", evt.RoomID.String()).Logger()
+	isOperatorsRoom := b.isOperatorsRoom(ctx, evt.RoomID)
+	if isOperatorsRoom {
+		if note, err := b.store.GetNote(ctx, redacts); err == nil {
+			if err := b.store.DeleteNote(ctx, redacts); err != nil {
+				log.Error().Err(err).Msg("cannot delete the internal note")
+				return
+			}
+			b.forgetMessage(ctx, note.ThreadID, "internal note has been deleted by the operator", redacts)
+			return
+		}
+	}
+
+	isReaction := false
+	if original, err := b.lp.GetClient().GetEvent(ctx, evt.RoomID, redacts); err == nil {
+		isReaction = original.Type == event.EventReaction
+	}
+	if isReaction && b.cfg.Get(ctx, config.RedactReactions.Key) != "true" {
+		return
+	}
+
+	relay, err := b.store.GetRelay(ctx, redacts)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Error().Err(err).Msg("cannot get relay of the redacted event")
+			return
+		}
+		if !isOperatorsRoom && !isReaction {
+			relay = b.findThreadRelay(ctx, evt.RoomID, redacts)
+		}
+	}
+	if relay == nil {
+		log.Debug().Msg("redacted event was not relayed")
+		return
+	}
+
+	reason := "deleted by the operator"
+	if !isOperatorsRoom {
+		reason = "deleted by the customer"
+	}
+	if _, err := b.lp.GetClient().RedactEvent(ctx, relay.RoomID, relay.RelayID, mautrix.ReqRedact{Reason: reason}); err != nil {
+		log.Error().Err(err).Msg("cannot redact the relayed event")
+	}
+	if isReaction {
+		return
+	}
+
+	b.forgetMessage(ctx, relay.ThreadID, "message has been "+reason, redacts, relay.RelayID)
+}
+
+// forgetMessage removes the deleted message (and its copy, if any) from the search index
+// and asks operators to clean up the redmine issue
+func (b *Bot) forgetMessage(ctx context.Context, threadID id.EventID, what string, eventIDs ...id.EventID) {
+	for _, eventID := range eventIDs {
+		if err := b.store.UnindexMessage(ctx, eventID); err != nil {
+			b.log.Warn().Err(err).Str("eventID", eventID.String()).Msg("cannot remove the redacted message from the search index")
+		}
+	}
+	// redmine journals cannot be deleted over API, so operators should clean it up manually
+	go b.addIssueNote(ctx, threadID, "_the "+what+", please remove its copy from the issue history manually, if needed_", true)
+}
+
+// findThreadRelay finds the copy of the customer message in the thread by the event_id metadata,
+// used for messages relayed before the relays were stored
+func (b *Bot) findThreadRelay(ctx context.Context, roomID id.RoomID, eventID id.EventID) *store.Relay {
+	ticket, err := b.store.GetOpenTicketByRoom(ctx, roomID)
+	if err != nil {
+		return nil
+	}
+	operatorsRoomID := b.operatorsRoom(ticket)
+	target := b.lp.FindEventBy(ctx, operatorsRoomID, map[string]string{"event_id": eventID.String()})
+	if target == nil {
+		return nil
+	}
+	return &store.Relay{
+		EventID:  eventID,
+		RelayID:  target.ID,
+		ThreadID: ticket.ThreadID,
+		RoomID:   operatorsRoomID,
+	}
+}
@@ -0,0 +1,157 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/format"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// saveRelay stores the mapping between the original event and its copy in the other room
+func (b *Bot) saveRelay(ctx context.Context, evtType event.Type, threadID, eventID, relayID id.EventID, roomID id.RoomID) {
+	if eventID == "" || relayID == "" {
+		return
+	}
+	err := b.store.AddRelay(ctx, &store.Relay{
+		EventID:   eventID,
+		RelayID:   relayID,
+		ThreadID:  threadID,
+		RoomID:    roomID,
+		EventType: evtType.Type,
+	})
+	if err != nil {
+		b.log.Error().Err(err).Str("eventID", eventID.String()).Msg("cannot save relay")
+	}
+}
+
+// mirroredEvent returns the counterpart of the thread event in the other room: the copy of the original event
+// or the original of the copy, empty if the event was not relayed
+func (b *Bot) mirroredEvent(ctx context.Context, threadID, eventID id.EventID) id.EventID {
+	if eventID == "" {
+		return ""
+	}
+	if relay, err := b.store.GetRelay(ctx, eventID); err == nil && relay.ThreadID == threadID {
+		return relay.RelayID
+	}
+	if relay, err := b.store.GetRelayByCopy(ctx, eventID); err == nil && relay.ThreadID == threadID {
+		return relay.EventID
+	}
+	return ""
+}
+
+// isEdit checks if the message replaces another message
+func isEdit(content *event.MessageEventContent) bool {
+	return content.RelatesTo != nil && content.RelatesTo.Type == event.RelReplace && content.NewContent != nil
+}
+
+// withSenderName adds the sender name header to the customer message copy in the thread
+func withSenderName(content *event.MessageEventContent, nameMD, nameHTML string) {
+	bodyMD := content.Body
+	if content.Body != "" {
+		content.Body = nameMD + ":\n" + content.Body
+	}
+	content.Format = event.FormatHTML
+	if content.FormattedBody != "" {
+		content.FormattedBody = nameHTML + ":<br>" + content.FormattedBody
+		return
+	}
+	formatted := format.RenderMarkdown(bodyMD, true, true)
+	if formatted.FormattedBody == "" {
+		content.FormattedBody = nameHTML + ":<br>" + bodyMD
+	} else {
+		content.FormattedBody = nameHTML + ":<br>" + formatted.FormattedBody
+	}
+}
+
+// relayEdit sends the edit of the original message as the edit of its copy in the other room
+func (b *Bot) relayEdit(ctx context.Context, evt *event.Event, content *event.MessageEventContent, byOperator bool) {
+	originalID := content.RelatesTo.EventID
+	log := b.log.With().Str("eventID", evt.ID.String()).Str("originalID", originalID.String()).Logger()
+	// only the author can edit the message, and only in the room where it was sent
+	original, err := b.lp.GetClient().GetEvent(ctx, evt.RoomID, originalID)
+	if err != nil || original.Sender != evt.Sender {
+		log.Warn().Err(err).Msg("edited message is not found in the room or has another sender")
+		return
+	}
+	relay, err := b.store.GetRelay(ctx, originalID)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			log.Error().Err(err).Msg("cannot get relay of the edited message")
+			return
+		}
+		// relayed before the relays were stored
+		if byOperator {
+			relay = b.findCustomerRelay(ctx, original)
+		} else {
+			relay = b.findThreadRelay(ctx, evt.RoomID, originalID)
+		}
+	}
+	if relay == nil {
+		log.Debug().Msg("edited message was not relayed")
+		return
+	}
+
+	newContent := *content.NewContent
+	newContent.RelatesTo = nil
+	newContent.NewContent = nil
+	newContent.Mentions = nil
+	if byOperator {
+		if b.readCommand(newContent.Body) != "" {
+			return
+		}
+		b.clearReply(&newContent)
+	} else {
+		nameMD, nameHTML := b.getName(ctx, evt.Sender)
+		withSenderName(&newContent, nameMD, nameHTML)
+	}
+	edit := newContent
+	edit.SetEdit(relay.RelayID)
+
+	fullContent := &event.Content{
+		Parsed: &edit,
+		Raw: map[string]any{
+			"event_id": evt.ID,
+		},
+	}
+	if _, err := b.lp.Send(ctx, relay.RoomID, fullContent); err != nil {
+		log.Error().Err(err).Msg("cannot relay edit")
+		return
+	}
+
+	role := "🧑‍🦱customer"
+	if byOperator {
+		role = "👩‍💼 operator"
+	}
+	go b.reindexMessage(ctx, relay, content.NewContent.Body, evt.Timestamp)
+	go b.addIssueNote(ctx, relay.ThreadID, fmt.Sprintf("_%s (%s, edited message)_\n\n%s", evt.Sender, role, content.NewContent.Body), false)
+}
+
+// findCustomerRelay finds the copy of the operator message in the customer room by the event_id metadata,
+// used for messages relayed before the relays were stored
+func (b *Bot) findCustomerRelay(ctx context.Context, original *event.Event) *store.Relay {
+	linkpearl.ParseContent(original, b.log)
+	threadID, err := b.findThread(original)
+	if err != nil {
+		return nil
+	}
+	roomID, err := b.findRoomID(ctx, threadID)
+	if err != nil {
+		return nil
+	}
+	target := b.lp.FindEventBy(ctx, roomID, map[string]string{"event_id": original.ID.String()})
+	if target == nil {
+		return nil
+	}
+	return &store.Relay{
+		EventID:  original.ID,
+		RelayID:  target.ID,
+		ThreadID: threadID,
+		RoomID:   roomID,
+	}
+}
@@ -0,0 +1,167 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// searchResultsLimit is the max amount of threads returned by the search command
+const searchResultsLimit = 10
+
+// indexMessage adds the message to the full-text search index
+func (b *Bot) indexMessage(ctx context.Context, threadID, eventID id.EventID, body string, ts int64) {
+	if err := b.store.IndexMessage(ctx, threadID, eventID, body, time.UnixMilli(ts).UTC()); err != nil {
+		b.log.Error().Err(err).Str("threadID", threadID.String()).Str("eventID", eventID.String()).Msg("cannot index message")
+	}
+}
+
+// reindexMessage replaces the indexed text of the relayed message with the text of its edit
+func (b *Bot) reindexMessage(ctx context.Context, relay *store.Relay, body string, ts int64) {
+	// the index rebuild stores customer messages under the IDs of their copies in the thread
+	if err := b.store.UnindexMessage(ctx, relay.RelayID); err != nil {
+		b.log.Error().Err(err).Str("eventID", relay.RelayID.String()).Msg("cannot remove message copy from the index")
+	}
+	if err := b.store.ReplaceIndexedMessage(ctx, relay.ThreadID, relay.EventID, body, time.UnixMilli(ts).UTC()); err != nil {
+		b.log.Error().Err(err).Str("threadID", relay.ThreadID.String()).Str("eventID", relay.EventID.String()).Msg("cannot reindex message")
+	}
+}
+
+func (b *Bot) searchRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	_, query := cutWords(strings.Replace(evt.Content.AsMessage().Body, b.prefix, "", 1), 1)
+	if query == "" {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" search QUERY`", nil, relatesTo)
+		return
+	}
+
+	results, err := b.store.Search(ctx, query, searchResultsLimit)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if len(results) == 0 {
+		b.SendNotice(ctx, evt.RoomID, "nothing found", nil, relatesTo)
+		return
+	}
+
+	var txt strings.Builder
+	txt.WriteString("Requests matching `" + query + "`:\n")
+	for _, result := range results {
+		ticket := result.Ticket
+		topic := ticket.Topic
+		if topic == "" {
+			topic = ticket.Customer.String()
+		}
+		snippet := strings.Join(strings.Fields(result.Snippet), " ")
+		fmt.Fprintf(&txt, "* [%s](https://matrix.to/#/%s/%s) - `%s`, %s: %s\n", topic, b.operatorsRoom(ticket), ticket.ThreadID, ticket.State, ticket.CreatedAt.Format(time.DateOnly), snippet)
+	}
+	b.SendNotice(ctx, evt.RoomID, txt.String(), nil, relatesTo)
+}
+
+func (b *Bot) reindexRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	b.mu.Lock("reindex")
+	defer b.mu.Unlock("reindex")
+
+	b.SendNotice(ctx, evt.RoomID, "rebuilding the search index from threads history, it may take a while...", nil, relatesTo)
+	count, err := b.rebuildSearchIndex(ctx)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, fmt.Sprintf("the search index has been rebuilt, %d messages indexed", count), nil, relatesTo)
+}
+
+// rebuildSearchIndex re-indexes messages of all threads in all operators rooms, thread by thread.
+// Threads missing from the tickets store are imported as closed requests
+func (b *Bot) rebuildSearchIndex(ctx context.Context) (int, error) {
+	var count int
+	for _, roomID := range b.getOperatorsRooms(ctx) {
+		var from string
+		for {
+			resp, err := b.lp.Threads(ctx, roomID, from)
+			if err != nil {
+				return count, err
+			}
+			for _, evt := range resp.Chunk {
+				ticket := b.getThreadTicket(ctx, roomID, evt)
+				if ticket == nil {
+					continue
+				}
+				indexed, err := b.reindexThread(ctx, ticket)
+				if err != nil {
+					return count, err
+				}
+				count += indexed
+			}
+			from = resp.NextBatch
+			if from == "" {
+				break
+			}
+		}
+	}
+	return count, nil
+}
+
+// getThreadTicket returns the ticket of the thread root, threads missing from the tickets store are imported as closed requests
+func (b *Bot) getThreadTicket(ctx context.Context, roomID id.RoomID, evt *event.Event) *store.Ticket {
+	ticket, err := b.store.GetTicket(ctx, evt.ID)
+	if err == nil {
+		return ticket
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		b.log.Error().Err(err).Str("threadID", evt.ID.String()).Msg("cannot get ticket")
+		return nil
+	}
+
+	evt = b.decryptEvent(ctx, evt)
+	if evt == nil {
+		return nil
+	}
+	customer := linkpearl.EventField[string](&evt.Content, "customer")
+	if customer == "" {
+		return nil
+	}
+	createdAt := time.UnixMilli(evt.Timestamp).UTC()
+	ticket = &store.Ticket{
+		ThreadID:        evt.ID,
+		Customer:        id.UserID(customer),
+		Homeserver:      linkpearl.EventField[string](&evt.Content, "homeserver"),
+		State:           store.StateDone,
+		CreatedAt:       createdAt,
+		ClosedAt:        createdAt,
+		OperatorsRoomID: roomID,
+	}
+	if err := b.store.AddTicket(ctx, ticket); err != nil {
+		b.log.Error().Err(err).Str("threadID", evt.ID.String()).Msg("cannot import ticket")
+		return nil
+	}
+	return ticket
+}
+
+// reindexThread replaces messages of the thread in the search index
+func (b *Bot) reindexThread(ctx context.Context, ticket *store.Ticket) (int, error) {
+	transcript, err := b.getTranscript(ctx, ticket, true)
+	if err != nil {
+		b.log.Warn().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot get thread messages")
+		return 0, nil
+	}
+	if err := b.store.UnindexThread(ctx, ticket.ThreadID); err != nil {
+		return 0, err
+	}
+	for i, msg := range transcript.Messages {
+		if err := b.store.IndexMessage(ctx, ticket.ThreadID, msg.EventID, msg.Body, msg.Timestamp); err != nil {
+			return i, err
+		}
+	}
+	return len(transcript.Messages), nil
+}
@@ -0,0 +1,124 @@
+package matrix
+
+import (
+	"context"
+	"time"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/metrics"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// CheckSLA warns operators about requests that are about to breach the SLA
+func (b *Bot) CheckSLA() {
+	ctx := context.Background()
+	responseSLA := b.getDuration(ctx, config.SLAResponse)
+	resolutionSLA := b.getDuration(ctx, config.SLAResolution)
+	if responseSLA == 0 && resolutionSLA == 0 {
+		return
+	}
+	lead := b.getDuration(ctx, config.SLAWarning)
+
+	tickets, err := b.store.ListOpenTickets(ctx)
+	if err != nil {
+		b.log.Error().Err(err).Msg("cannot list open tickets")
+		return
+	}
+
+	now := time.Now().UTC()
+	for _, ticket := range tickets {
+		if ticket.FirstMessageAt.IsZero() {
+			continue
+		}
+		if responseSLA > 0 && ticket.FirstResponseAt.IsZero() && ticket.ResponseWarnedAt.IsZero() {
+			remaining := responseSLA - b.slaElapsed(ctx, ticket.FirstMessageAt, now)
+			if remaining <= lead {
+				b.warnSLA(ctx, ticket, "first response", responseSLA, remaining)
+				if err := b.store.SetResponseWarnedAt(ctx, ticket.ThreadID, now); err != nil {
+					b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot store SLA warning time")
+				}
+			}
+		}
+		if resolutionSLA > 0 && ticket.ResolutionWarnedAt.IsZero() {
+			remaining := resolutionSLA - b.slaElapsed(ctx, ticket.FirstMessageAt, now)
+			if remaining <= lead {
+				b.warnSLA(ctx, ticket, "resolution", resolutionSLA, remaining)
+				if err := b.store.SetResolutionWarnedAt(ctx, ticket.ThreadID, now); err != nil {
+					b.log.Error().Err(err).Str("threadID", ticket.ThreadID.String()).Msg("cannot store SLA warning time")
+				}
+			}
+		}
+	}
+}
+
+// warnSLA posts the SLA warning into the thread, mentioning the assignee (if any)
+func (b *Bot) warnSLA(ctx context.Context, ticket *store.Ticket, name string, sla, remaining time.Duration) {
+	text := "⚠️ " + name + " SLA (" + formatDuration(sla) + ") "
+	if remaining > 0 {
+		text += "will be breached in " + formatDuration(remaining)
+	} else {
+		text += "has been breached"
+	}
+	var raw map[string]any
+	if ticket.Assignee != "" {
+		text += ", " + ticket.Assignee.String()
+		raw = map[string]any{"m.mentions": event.Mentions{UserIDs: []id.UserID{ticket.Assignee}}}
+	}
+	b.SendNotice(ctx, b.operatorsRoom(ticket), text, raw, linkpearl.RelatesTo(ticket.ThreadID))
+}
+
+// trackFirstMessage stores the time of the first customer message, the SLA start
+func (b *Bot) trackFirstMessage(ctx context.Context, threadID id.EventID, ts time.Time) {
+	if _, err := b.store.SetFirstMessageAt(ctx, threadID, ts); err != nil {
+		b.log.Error().Err(err).Str("threadID", threadID.String()).Msg("cannot store first message time")
+	}
+}
+
+// trackFirstResponse stores the time of the first operator reply and records the first response SLA metrics
+func (b *Bot) trackFirstResponse(ctx context.Context, threadID id.EventID, ts time.Time) {
+	updated, err := b.store.SetFirstResponseAt(ctx, threadID, ts)
+	if err != nil {
+		b.log.Error().Err(err).Str("threadID", threadID.String()).Msg("cannot store first response time")
+		return
+	}
+	if !updated {
+		return
+	}
+	ticket, err := b.store.GetTicket(ctx, threadID)
+	if err != nil {
+		b.log.Error().Err(err).Str("threadID", threadID.String()).Msg("cannot get ticket")
+		return
+	}
+	elapsed := b.slaElapsed(ctx, ticket.FirstMessageAt, ts)
+	sla := b.getDuration(ctx, config.SLAResponse)
+	metrics.SLAFirstResponse(elapsed, sla > 0 && elapsed > sla)
+}
+
+// trackResolution records the resolution SLA metrics of the ticket
+func (b *Bot) trackResolution(ctx context.Context, ticket *store.Ticket, ts time.Time) {
+	start := ticket.FirstMessageAt
+	if start.IsZero() {
+		start = ticket.CreatedAt
+	}
+	elapsed := b.slaElapsed(ctx, start, ts)
+	sla := b.getDuration(ctx, config.SLAResolution)
+	metrics.SLAResolution(elapsed, sla > 0 && elapsed > sla)
+}
+
+// slaElapsed returns the time between from and to, counted towards SLA
+func (b *Bot) slaElapsed(ctx context.Context, from, to time.Time) time.Duration {
+	return b.elapsed(ctx, config.SLABusinessHours, from, to)
+}
+
+// getDuration returns the value of the duration config option, invalid values are treated as 0
+func (b *Bot) getDuration(ctx context.Context, option *config.Option) time.Duration {
+	d, err := config.ParseDuration(b.cfg.Get(ctx, option.Key))
+	if err != nil || d < 0 {
+		return 0
+	}
+	return d
+}
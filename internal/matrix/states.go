@@ -0,0 +1,135 @@
+package matrix
+
+import (
+	"context"
+	"strings"
+
+	"github.com/etkecc/go-linkpearl"
+	"github.com/etkecc/go-redmine"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/matrix/config"
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// statePrefixes maps ticket states to the config options of their thread topic prefixes
+var statePrefixes = map[string]*config.Option{
+	store.StateOpen:      config.TextPrefixOpen,
+	store.StateWaiting:   config.TextPrefixWaiting,
+	store.StateOnHold:    config.TextPrefixOnHold,
+	store.StateEscalated: config.TextPrefixEscalated,
+	store.StateDone:      config.TextPrefixDone,
+	store.StateMerged:    config.TextPrefixMerged,
+	store.StateMoved:     config.TextPrefixMoved,
+}
+
+// manualStates can be set by operators with the status command, closing is handled by the done command
+var manualStates = []string{store.StateOpen, store.StateWaiting, store.StateOnHold, store.StateEscalated}
+
+// stateRedmineStatuses maps ticket states to redmine statuses, states without redmine counterpart are not synced
+var stateRedmineStatuses = map[string]redmine.Status{
+	store.StateOpen:    redmine.WaitingForOperator,
+	store.StateWaiting: redmine.WaitingForCustomer,
+	store.StateDone:    redmine.Done,
+}
+
+// getStatePrefix returns the thread topic prefix of the state
+func (b *Bot) getStatePrefix(ctx context.Context, state string) string {
+	option, ok := statePrefixes[state]
+	if !ok {
+		return ""
+	}
+	return b.cfg.Get(ctx, option.Key)
+}
+
+// getTopic returns the current (possibly renamed) thread topic without state prefixes
+func (b *Bot) getTopic(ctx context.Context, threadID id.EventID) (body, formattedBody string, err error) {
+	roomID := b.threadRoom(ctx, threadID)
+	threadEvt, err := b.lp.GetClient().GetEvent(ctx, roomID, threadID)
+	if err != nil {
+		return "", "", err
+	}
+	linkpearl.ParseContent(threadEvt, b.log)
+	threadMsg := threadEvt.Content.AsMessage()
+	if lastEdit := b.getLastEdit(ctx, roomID, threadID); lastEdit != nil {
+		threadMsg = lastEdit.Content.AsMessage()
+	}
+
+	body, formattedBody = b.getContentBody(threadMsg)
+	topic := &event.MessageEventContent{Body: body, FormattedBody: formattedBody}
+	b.clearPrefix(ctx, topic)
+	return strings.TrimSpace(topic.Body), strings.TrimSpace(topic.FormattedBody), nil
+}
+
+// updateTopic renders the thread topic using the stored topic text and the ticket state, priority, tags and assignee
+func (b *Bot) updateTopic(ctx context.Context, threadID id.EventID) error {
+	ticket, err := b.store.GetTicket(ctx, threadID)
+	if err != nil {
+		return err
+	}
+
+	if ticket.Topic == "" {
+		ticket.Topic, ticket.TopicHTML, err = b.getTopic(ctx, threadID)
+		if err != nil {
+			return err
+		}
+		if err := b.store.SetTopic(ctx, threadID, ticket.Topic, ticket.TopicHTML); err != nil {
+			return err
+		}
+	}
+
+	body := ticket.Topic
+	formattedBody := ticket.TopicHTML
+	if formattedBody == "" {
+		formattedBody = body
+	}
+	if ticket.Priority != "" && ticket.Priority != store.PriorityNormal {
+		prefix := "[" + strings.ToUpper(ticket.Priority) + "]"
+		body = prefix + " " + body
+		formattedBody = prefix + " " + formattedBody
+	}
+	if prefix := b.getStatePrefix(ctx, ticket.State); prefix != "" {
+		body = prefix + " " + body
+		formattedBody = prefix + " " + formattedBody
+	}
+	tags, err := b.store.GetTags(ctx, threadID)
+	if err != nil {
+		b.log.Warn().Err(err).Str("threadID", threadID.String()).Msg("cannot get ticket tags")
+	}
+	for _, tag := range tags {
+		body += " #" + tag
+		formattedBody += " #" + tag
+	}
+	if ticket.Assignee != "" {
+		nameMD, nameHTML := b.getName(ctx, ticket.Assignee)
+		body += " (assigned to " + nameMD + ")"
+		formattedBody += " (assigned to " + nameHTML + ")"
+	}
+
+	return b.replace(ctx, threadID, "", "", body, formattedBody)
+}
+
+// setState changes the ticket state and updates the thread topic accordingly
+func (b *Bot) setState(ctx context.Context, threadID id.EventID, state string) error {
+	if err := b.store.SetState(ctx, threadID, state); err != nil {
+		return err
+	}
+	return b.updateTopic(ctx, threadID)
+}
+
+// transitionState changes the ticket state only if the ticket is in the "from" state,
+// used for automatic transitions when the customer or operator replies
+func (b *Bot) transitionState(ctx context.Context, threadID id.EventID, from, to string) {
+	key := "state_" + threadID.String()
+	b.mu.Lock(key)
+	defer b.mu.Unlock(key)
+
+	ticket, err := b.getTicket(ctx, threadID)
+	if err != nil || ticket.State != from {
+		return
+	}
+	if err := b.setState(ctx, threadID, to); err != nil {
+		b.log.Error().Err(err).Str("threadID", threadID.String()).Str("from", from).Str("to", to).Msg("cannot change ticket state")
+	}
+}
@@ -31,6 +31,30 @@ func (b *Bot) initSync() {
 			go b.onReaction(ctx, evt)
 		},
 	)
+	b.lp.OnEventType(
+		event.EventRedaction,
+		func(ctx context.Context, evt *event.Event) {
+			go b.onRedaction(ctx, evt)
+		},
+	)
+	b.lp.OnEventType(
+		event.EphemeralEventTyping,
+		func(ctx context.Context, evt *event.Event) {
+			go b.onTyping(ctx, evt)
+		},
+	)
+	b.lp.OnEventType(
+		event.EphemeralEventReceipt,
+		func(ctx context.Context, evt *event.Event) {
+			go b.onReceipt(ctx, evt)
+		},
+	)
+	b.lp.OnEventType(
+		event.EventUnstablePollResponse,
+		func(ctx context.Context, evt *event.Event) {
+			go b.onPollResponse(ctx, evt)
+		},
+	)
 	b.lp.OnEventType(
 		event.EventEncrypted,
 		func(ctx context.Context, evt *event.Event) {
@@ -43,6 +67,18 @@ func (b *Bot) initSync() {
 			go b.onMessage(ctx, evt)
 		},
 	)
+	b.lp.OnEventType(
+		event.EventSticker,
+		func(ctx context.Context, evt *event.Event) {
+			go b.onMessage(ctx, evt)
+		},
+	)
+	b.lp.OnEventType(
+		event.EventUnstablePollStart,
+		func(ctx context.Context, evt *event.Event) {
+			go b.onMessage(ctx, evt)
+		},
+	)
 }
 
 // joinPermit is called by linkpearl when processing "invite" events and deciding if rooms should be auto-joined or not
@@ -63,18 +99,19 @@ func (b *Bot) joinPermit(ctx context.Context, evt *event.Event) bool {
 
 func (b *Bot) onJoin(ctx context.Context, evt *event.Event, threadID id.EventID) {
 	name, _ := b.getName(ctx, evt.Sender)
-	b.SendNotice(ctx, b.roomID, fmt.Sprintf(b.cfg.Get(ctx, config.TextJoin.Key), name), nil, linkpearl.RelatesTo(threadID))
+	b.SendNotice(ctx, b.threadRoom(ctx, threadID), fmt.Sprintf(b.cfg.Get(ctx, config.TextJoin.Key), name), nil, linkpearl.RelatesTo(threadID))
 }
 
 func (b *Bot) onInvite(ctx context.Context, evt *event.Event, threadID id.EventID) {
 	nameSender, _ := b.getName(ctx, evt.Sender)
 	nameTarget, _ := b.getName(ctx, id.UserID(evt.GetStateKey()))
-	b.SendNotice(ctx, b.roomID, fmt.Sprintf(b.cfg.Get(ctx, config.TextInvite.Key), nameSender, nameTarget), nil, linkpearl.RelatesTo(threadID))
+	b.SendNotice(ctx, b.threadRoom(ctx, threadID), fmt.Sprintf(b.cfg.Get(ctx, config.TextInvite.Key), nameSender, nameTarget), nil, linkpearl.RelatesTo(threadID))
 }
 
 func (b *Bot) onLeave(ctx context.Context, evt *event.Event, threadID id.EventID) {
 	name, _ := b.getName(ctx, id.UserID(evt.GetStateKey()))
-	b.SendNotice(ctx, b.roomID, fmt.Sprintf(b.cfg.Get(ctx, config.TextLeave.Key), name), nil, linkpearl.RelatesTo(threadID))
+	operatorsRoomID := b.threadRoom(ctx, threadID)
+	b.SendNotice(ctx, operatorsRoomID, fmt.Sprintf(b.cfg.Get(ctx, config.TextLeave.Key), name), nil, linkpearl.RelatesTo(threadID))
 
 	members, err := b.lp.GetClient().StateStore.GetRoomJoinedOrInvitedMembers(ctx, evt.RoomID)
 	if err != nil {
@@ -84,7 +121,7 @@ func (b *Bot) onLeave(ctx context.Context, evt *event.Event, threadID id.EventID
 
 	count := len(members)
 	if count == 1 && members[0] == b.lp.GetClient().UserID {
-		b.SendNotice(ctx, b.roomID, b.cfg.Get(ctx, config.TextEmptyRoom.Key), nil, linkpearl.RelatesTo(threadID))
+		b.SendNotice(ctx, operatorsRoomID, b.cfg.Get(ctx, config.TextEmptyRoom.Key), nil, linkpearl.RelatesTo(threadID))
 	}
 }
 
@@ -139,9 +176,50 @@ func (b *Bot) onReaction(ctx context.Context, evt *event.Event) {
 		return
 	}
 
+	if b.handleSurveyReaction(ctx, evt) {
+		return
+	}
+
 	b.forwardReaction(ctx, evt)
 }
 
+func (b *Bot) onRedaction(ctx context.Context, evt *event.Event) {
+	// ignore own redactions
+	if evt.Sender == b.lp.GetClient().UserID {
+		return
+	}
+
+	// mautrix 0.15.x migration
+	if b.ignoreBefore >= evt.Timestamp {
+		return
+	}
+
+	// ignore any events in ignored rooms
+	if slices.Contains(strings.Split(b.cfg.Get(ctx, config.IgnoredRooms.Key), ","), evt.RoomID.String()) {
+		return
+	}
+
+	b.forwardRedaction(ctx, evt)
+}
+
+func (b *Bot) onTyping(ctx context.Context, evt *event.Event) {
+	// ignore any events in ignored rooms
+	if slices.Contains(strings.Split(b.cfg.Get(ctx, config.IgnoredRooms.Key), ","), evt.RoomID.String()) {
+		return
+	}
+
+	b.forwardTyping(ctx, evt)
+}
+
+func (b *Bot) onReceipt(ctx context.Context, evt *event.Event) {
+	// ignore any events in ignored rooms
+	if slices.Contains(strings.Split(b.cfg.Get(ctx, config.IgnoredRooms.Key), ","), evt.RoomID.String()) {
+		return
+	}
+
+	b.forwardReceipt(ctx, evt)
+}
+
 func (b *Bot) onEncryptedMessage(ctx context.Context, evt *event.Event) {
 	// ignore own messages
 	if evt.Sender == b.lp.GetClient().UserID {
@@ -154,7 +232,7 @@ func (b *Bot) onEncryptedMessage(ctx context.Context, evt *event.Event) {
 	}
 
 	// if that's an operator room, ignore
-	if b.roomID == evt.RoomID {
+	if b.isOperatorsRoom(ctx, evt.RoomID) {
 		return
 	}
 
@@ -164,8 +242,7 @@ func (b *Bot) onEncryptedMessage(ctx context.Context, evt *event.Event) {
 	}
 
 	// if the room already mapped, i.e. it already has own thread, ignore, and handle it in the onMessage
-	mapping, err := b.getMapping(ctx, evt.RoomID.String())
-	if mapping != "" || err == nil {
+	if _, err := b.store.GetOpenTicketByRoom(ctx, evt.RoomID); err == nil {
 		return
 	}
 
@@ -0,0 +1,283 @@
+package matrix
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"html"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/etkecc/go-linkpearl"
+	"maunium.net/go/mautrix"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// transcriptTimeLayout is used to render message timestamps in transcripts
+const transcriptTimeLayout = "2006-01-02 15:04 MST"
+
+// transcriptFormats maps supported transcript formats to their content types
+var transcriptFormats = map[string]string{
+	"md":   "text/markdown",
+	"html": "text/html",
+	"json": "application/json",
+}
+
+// Transcript of a request conversation
+type Transcript struct {
+	ThreadID  id.EventID           `json:"thread_id"`
+	Customer  id.UserID            `json:"customer"`
+	Topic     string               `json:"topic"`
+	State     string               `json:"state"`
+	CreatedAt time.Time            `json:"created_at"`
+	ClosedAt  *time.Time           `json:"closed_at,omitempty"`
+	Messages  []*TranscriptMessage `json:"messages"`
+}
+
+// TranscriptMessage is a single message of the transcript
+type TranscriptMessage struct {
+	EventID       id.EventID `json:"event_id"`
+	Sender        id.UserID  `json:"sender"`
+	SenderName    string     `json:"sender_name"`
+	Customer      bool       `json:"customer"`
+	Timestamp     time.Time  `json:"timestamp"`
+	Body          string     `json:"body"`
+	FormattedBody string     `json:"formatted_body,omitempty"`
+	File          string     `json:"file,omitempty"`
+	Internal      bool       `json:"internal,omitempty"` // internal operator note, never shown to the customer
+}
+
+func (b *Bot) transcriptRequest(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if evt.Content.AsMessage().RelatesTo == nil {
+		b.SendNotice(ctx, evt.RoomID, "the message doesn't relate to any thread, so I don't know which request you mean.", nil, relatesTo)
+		return
+	}
+	threadID, err := b.findThread(evt)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	ticket, err := b.store.GetTicket(ctx, threadID)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+
+	format := "md"
+	if args := b.parseCommand(evt.Content.AsMessage().Body); len(args) > 1 {
+		format = strings.ToLower(args[1])
+	}
+	if _, ok := transcriptFormats[format]; !ok {
+		b.SendNotice(ctx, evt.RoomID, "unknown transcript format `"+format+"`, available formats: `md`, `html`, `json`", nil, relatesTo)
+		return
+	}
+
+	if err := b.sendTranscript(ctx, ticket, evt.RoomID, format, true, linkpearl.RelatesTo(threadID)); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+	}
+}
+
+// sendTranscript renders the request transcript and uploads it into the room,
+// internal notes are included only when the transcript is sent to operators
+func (b *Bot) sendTranscript(ctx context.Context, ticket *store.Ticket, roomID id.RoomID, format string, internal bool, relatesTo ...*event.RelatesTo) error {
+	transcript, err := b.getTranscript(ctx, ticket, internal)
+	if err != nil {
+		return err
+	}
+	data, err := transcript.Render(format)
+	if err != nil {
+		return err
+	}
+
+	req := &mautrix.ReqUploadMedia{
+		ContentBytes:  data,
+		ContentLength: int64(len(data)),
+		ContentType:   transcriptFormats[format],
+		FileName:      "transcript-" + transcript.CreatedAt.Format(time.DateOnly) + "." + format,
+	}
+	return b.lp.SendFile(ctx, roomID, req, event.MsgFile, relatesTo...)
+}
+
+// getTranscript walks the thread and collects the conversation between the customer and operators,
+// with internal notes of operators, if requested
+func (b *Bot) getTranscript(ctx context.Context, ticket *store.Ticket, internal bool) (*Transcript, error) {
+	transcript := &Transcript{
+		ThreadID:  ticket.ThreadID,
+		Customer:  ticket.Customer,
+		Topic:     ticket.Topic,
+		State:     ticket.State,
+		CreatedAt: ticket.CreatedAt,
+		Messages:  []*TranscriptMessage{},
+	}
+	if !ticket.ClosedAt.IsZero() {
+		transcript.ClosedAt = &ticket.ClosedAt
+	}
+	if transcript.Topic == "" {
+		transcript.Topic, _, _ = b.getTopic(ctx, ticket.ThreadID) //nolint:errcheck // topic is optional
+	}
+
+	var from string
+	for {
+		resp, err := b.lp.Relations(ctx, b.operatorsRoom(ticket), ticket.ThreadID, "m.thread", from)
+		if err != nil {
+			return nil, err
+		}
+		for _, evt := range resp.Chunk {
+			if msg := b.toTranscriptMessage(ctx, ticket, evt); msg != nil {
+				transcript.Messages = append(transcript.Messages, msg)
+			}
+		}
+		from = resp.NextBatch
+		if from == "" {
+			break
+		}
+	}
+	if internal {
+		notes, err := b.store.ListNotes(ctx, ticket.ThreadID)
+		if err != nil {
+			return nil, err
+		}
+		for _, note := range notes {
+			transcript.Messages = append(transcript.Messages, &TranscriptMessage{
+				EventID:    note.EventID,
+				Sender:     note.Author,
+				SenderName: b.getDisplayName(ctx, note.Author),
+				Timestamp:  note.CreatedAt,
+				Body:       note.Body,
+				Internal:   true,
+			})
+		}
+	}
+	sort.SliceStable(transcript.Messages, func(i, j int) bool {
+		return transcript.Messages[i].Timestamp.Before(transcript.Messages[j].Timestamp)
+	})
+
+	return transcript, nil
+}
+
+// toTranscriptMessage converts the thread event into transcript message, returns nil for events that are not a part of the conversation
+func (b *Bot) toTranscriptMessage(ctx context.Context, ticket *store.Ticket, evt *event.Event) *TranscriptMessage {
+	evt = b.decryptEvent(ctx, evt)
+	if evt == nil || (evt.Type != event.EventMessage && evt.Type != event.EventSticker && evt.Type != event.EventUnstablePollStart) {
+		return nil
+	}
+	content := asMessage(evt)
+	if content == nil || content.MsgType == event.MsgNotice || b.readCommand(content.Body) != "" {
+		return nil
+	}
+	// bot messages that are not customer copies (warnings, survey results, etc.) are not part of the conversation
+	_, isRelay := evt.Content.Raw["event_id"]
+	isBot := evt.Sender == b.lp.GetClient().UserID
+	if isBot && !isRelay {
+		return nil
+	}
+	if lastEdit := b.getLastEdit(ctx, b.operatorsRoom(ticket), evt.ID); lastEdit != nil && lastEdit.Content.AsMessage().NewContent != nil {
+		content = lastEdit.Content.AsMessage().NewContent
+	}
+
+	msg := &TranscriptMessage{
+		EventID:       evt.ID,
+		Sender:        evt.Sender,
+		Timestamp:     time.UnixMilli(evt.Timestamp).UTC(),
+		Body:          content.Body,
+		FormattedBody: content.FormattedBody,
+	}
+	if content.URL != "" || content.File != nil {
+		_, fileURL := GetFileURL(content)
+		msg.File = string(fileURL)
+	}
+	// customer messages are sent into the thread by the bot, with the original event ID and the customer name header
+	if isRelay && isBot {
+		msg.Sender = ticket.Customer
+		msg.Customer = true
+		if _, body, ok := strings.Cut(msg.Body, ":\n"); ok {
+			msg.Body = body
+		}
+		if _, body, ok := strings.Cut(msg.FormattedBody, ":<br>"); ok {
+			msg.FormattedBody = body
+		}
+	}
+	msg.SenderName = b.getDisplayName(ctx, msg.Sender)
+	return msg
+}
+
+// decryptEvent parses the event content and decrypts it if needed, returns nil if the event cannot be decrypted
+func (b *Bot) decryptEvent(ctx context.Context, evt *event.Event) *event.Event {
+	linkpearl.ParseContent(evt, b.log)
+	if evt.Type != event.EventEncrypted {
+		return evt
+	}
+	decrypted, err := b.lp.GetClient().Crypto.Decrypt(ctx, evt)
+	if err != nil {
+		b.log.Warn().Err(err).Str("eventID", evt.ID.String()).Msg("cannot decrypt event")
+		return nil
+	}
+	linkpearl.ParseContent(decrypted, b.log)
+	return decrypted
+}
+
+// Header returns the message timestamp, with the internal note mark, if needed
+func (m *TranscriptMessage) Header() string {
+	if m.Internal {
+		return m.Timestamp.Format(transcriptTimeLayout) + ", internal note"
+	}
+	return m.Timestamp.Format(transcriptTimeLayout)
+}
+
+// Render the transcript in the format (md, html, json)
+func (t *Transcript) Render(format string) ([]byte, error) {
+	switch format {
+	case "json":
+		return json.MarshalIndent(t, "", "  ")
+	case "html":
+		return t.renderHTML(), nil
+	default:
+		return t.renderMarkdown(), nil
+	}
+}
+
+func (t *Transcript) renderMarkdown() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# " + t.Topic + "\n\n")
+	buf.WriteString("* Customer: " + t.Customer.String() + "\n")
+	buf.WriteString("* Created: " + t.CreatedAt.Format(transcriptTimeLayout) + "\n")
+	if t.ClosedAt != nil {
+		buf.WriteString("* Closed: " + t.ClosedAt.Format(transcriptTimeLayout) + "\n")
+	}
+	for _, msg := range t.Messages {
+		buf.WriteString("\n---\n\n**" + msg.SenderName + "** (" + msg.Header() + "):\n\n")
+		buf.WriteString(msg.Body + "\n")
+		if msg.File != "" {
+			buf.WriteString("\nFile: " + msg.File + "\n")
+		}
+	}
+	return buf.Bytes()
+}
+
+func (t *Transcript) renderHTML() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head><meta charset=\"utf-8\"><title>" + html.EscapeString(t.Topic) + "</title></head>\n<body>\n")
+	buf.WriteString("<h1>" + html.EscapeString(t.Topic) + "</h1>\n<ul>\n")
+	buf.WriteString("<li>Customer: " + html.EscapeString(t.Customer.String()) + "</li>\n")
+	buf.WriteString("<li>Created: " + t.CreatedAt.Format(transcriptTimeLayout) + "</li>\n")
+	if t.ClosedAt != nil {
+		buf.WriteString("<li>Closed: " + t.ClosedAt.Format(transcriptTimeLayout) + "</li>\n")
+	}
+	buf.WriteString("</ul>\n")
+	for _, msg := range t.Messages {
+		// formatted body is not used on purpose: the file may be opened in a browser, so the content must be escaped
+		body := strings.ReplaceAll(html.EscapeString(msg.Body), "\n", "<br>")
+		buf.WriteString("<hr>\n<p><b>" + html.EscapeString(msg.SenderName) + "</b> (" + msg.Header() + "):</p>\n")
+		buf.WriteString("<div>" + body + "</div>\n")
+		if msg.File != "" {
+			buf.WriteString("<p>File: " + html.EscapeString(msg.File) + "</p>\n")
+		}
+	}
+	buf.WriteString("</body>\n</html>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,255 @@
+package matrix
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/etkecc/go-linkpearl"
+	"golang.org/x/exp/slices"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/etkecc/honoroit/internal/store"
+)
+
+// triageActions are reserved and cannot be used as triage rule names
+var triageActions = []string{"list", "save", "delete", "rm", "remove"}
+
+// triageResult is the combined outcome of the triage rules matching the first customer message
+type triageResult struct {
+	Rules    []string // names of the matched rules
+	Tags     []string
+	Priority string    // the highest priority of the matched rules
+	Queue    string    // queue of the first matched rule with a queue
+	Assignee id.UserID // assignee of the first matched rule with an assignee
+}
+
+// String describes the matched rules, used in the thread root notice and the redmine issue
+func (t *triageResult) String() string {
+	if t == nil || len(t.Rules) == 0 {
+		return ""
+	}
+	return "auto-triage: " + strings.Join(t.Rules, ", ")
+}
+
+// compileTriagePattern compiles the rule pattern, patterns are case-insensitive
+func compileTriagePattern(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("(?i)" + pattern)
+}
+
+// triageRequest evaluates triage rules against the first customer message
+func (b *Bot) triageRequest(ctx context.Context, body string) *triageResult {
+	result := &triageResult{}
+	if strings.TrimSpace(body) == "" {
+		return result
+	}
+	rules, err := b.store.ListTriageRules(ctx)
+	if err != nil {
+		b.log.Error().Err(err).Msg("cannot list triage rules")
+		return result
+	}
+
+	for _, rule := range rules {
+		pattern, err := compileTriagePattern(rule.Pattern)
+		if err != nil {
+			b.log.Warn().Err(err).Str("rule", rule.Name).Msg("cannot compile triage rule pattern")
+			continue
+		}
+		if !pattern.MatchString(body) {
+			continue
+		}
+		result.Rules = append(result.Rules, rule.Name)
+		if rule.Tag != "" && !slices.Contains(result.Tags, rule.Tag) {
+			result.Tags = append(result.Tags, rule.Tag)
+		}
+		if slices.Index(store.Priorities, rule.Priority) > slices.Index(store.Priorities, result.Priority) {
+			result.Priority = rule.Priority
+		}
+		if result.Queue == "" {
+			result.Queue = rule.Queue
+		}
+		if result.Assignee == "" {
+			result.Assignee = rule.Assignee
+		}
+	}
+	return result
+}
+
+// applyTriage sets tags, priority and assignee of the matched triage rules to the new ticket
+func (b *Bot) applyTriage(ctx context.Context, threadID id.EventID, result *triageResult) {
+	if len(result.Rules) == 0 {
+		return
+	}
+	log := b.log.With().Str("threadID", threadID.String()).Strs("rules", result.Rules).Logger()
+	for _, tag := range result.Tags {
+		if err := b.store.AddTag(ctx, threadID, tag); err != nil {
+			log.Error().Err(err).Str("tag", tag).Msg("cannot add triage tag")
+		}
+	}
+	if result.Priority != "" {
+		if err := b.store.SetPriority(ctx, threadID, result.Priority); err != nil {
+			log.Error().Err(err).Msg("cannot set triage priority")
+		}
+	}
+	if result.Assignee != "" {
+		if err := b.store.SetAssignee(ctx, threadID, result.Assignee); err != nil {
+			log.Error().Err(err).Msg("cannot set triage assignee")
+		}
+	}
+	if len(result.Tags) == 0 && result.Priority == "" && result.Assignee == "" {
+		return
+	}
+	if err := b.updateTopic(ctx, threadID); err != nil {
+		log.Error().Err(err).Msg("cannot update topic after triage")
+	}
+	go b.updateIssueFields(ctx, threadID)
+}
+
+func (b *Bot) ruleRequest(ctx context.Context, evt *event.Event) {
+	body := strings.TrimSpace(evt.Content.AsMessage().Body)
+	words, pattern := cutWords(strings.Replace(body, b.prefix, "", 1), 4)
+	var action, name string
+	if len(words) > 1 {
+		action = strings.ToLower(words[1])
+	}
+	if len(words) > 2 {
+		name = strings.ToLower(words[2])
+	}
+
+	switch action {
+	case "", "list":
+		b.listTriageRules(ctx, evt)
+	case "save":
+		var actions string
+		if len(words) > 3 {
+			actions = words[3]
+		}
+		b.saveTriageRule(ctx, evt, name, actions, pattern)
+	case "delete", "rm", "remove":
+		b.deleteTriageRule(ctx, evt, name)
+	default:
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" rule list`, `"+b.prefix+" rule save NAME ACTIONS REGEX`, `"+b.prefix+" rule delete NAME`", nil, linkpearl.EventRelatesTo(evt))
+	}
+}
+
+func (b *Bot) listTriageRules(ctx context.Context, evt *event.Event) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	rules, err := b.store.ListTriageRules(ctx)
+	if err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	if len(rules) == 0 {
+		b.SendNotice(ctx, evt.RoomID, "there are no triage rules yet, use `"+b.prefix+" rule save NAME ACTIONS REGEX` to create one", nil, relatesTo)
+		return
+	}
+
+	var txt strings.Builder
+	txt.WriteString("Triage rules, in the order of evaluation:\n\n")
+	for _, rule := range rules {
+		fmt.Fprintf(&txt, "* `%s` - `%s` → `%s`\n", rule.Name, rule.Pattern, formatTriageActions(rule))
+	}
+	b.SendNotice(ctx, evt.RoomID, txt.String(), nil, relatesTo)
+}
+
+// formatTriageActions renders rule actions in the same format they are saved with
+func formatTriageActions(rule *store.TriageRule) string {
+	actions := []string{}
+	if rule.Tag != "" {
+		actions = append(actions, "tag:"+rule.Tag)
+	}
+	if rule.Priority != "" {
+		actions = append(actions, "priority:"+rule.Priority)
+	}
+	if rule.Queue != "" {
+		actions = append(actions, "queue:"+rule.Queue)
+	}
+	if rule.Assignee != "" {
+		actions = append(actions, "assignee:"+rule.Assignee.String())
+	}
+	return strings.Join(actions, ",")
+}
+
+// parseTriageActions parses comma-separated TYPE:VALUE actions into the rule
+func (b *Bot) parseTriageActions(ctx context.Context, rule *store.TriageRule, actions string) error {
+	for _, action := range strings.Split(actions, ",") {
+		actionType, value, ok := strings.Cut(strings.TrimSpace(action), ":")
+		value = strings.TrimSpace(value)
+		if !ok || value == "" {
+			return fmt.Errorf("invalid action %q, expected TYPE:VALUE, where TYPE is one of: tag, priority, queue, assignee", action)
+		}
+		switch strings.ToLower(actionType) {
+		case "tag":
+			rule.Tag = normalizeTag(value)
+		case "priority":
+			rule.Priority = strings.ToLower(value)
+			if !slices.Contains(store.Priorities, rule.Priority) {
+				return fmt.Errorf("unknown priority `%s`, available priorities: `%s`", value, strings.Join(store.Priorities, "`, `"))
+			}
+		case "queue":
+			queue, err := b.getQueueByName(ctx, strings.ToLower(value))
+			if err != nil {
+				return err
+			}
+			rule.Queue = queue.Name
+		case "assignee":
+			rule.Assignee = id.UserID(value)
+			if _, _, err := rule.Assignee.Parse(); err != nil {
+				return fmt.Errorf("invalid assignee %q: %w", value, err)
+			}
+		default:
+			return fmt.Errorf("unknown action type %q, expected one of: tag, priority, queue, assignee", actionType)
+		}
+	}
+	return nil
+}
+
+func (b *Bot) saveTriageRule(ctx context.Context, evt *event.Event, name, actions, pattern string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if name == "" || actions == "" || pattern == "" {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" rule save NAME ACTIONS REGEX`, e.g. `"+b.prefix+" rule save refunds tag:billing,priority:high refund|chargeback`", nil, relatesTo)
+		return
+	}
+	if !macroNameRegex.MatchString(name) || slices.Contains(triageActions, name) {
+		b.SendNotice(ctx, evt.RoomID, "invalid rule name `"+name+"`, use lowercase letters, numbers, `_`, `.` and `-` only", nil, relatesTo)
+		return
+	}
+	if _, err := compileTriagePattern(pattern); err != nil {
+		b.SendNotice(ctx, evt.RoomID, "invalid regular expression: "+err.Error(), nil, relatesTo)
+		return
+	}
+
+	rule := &store.TriageRule{Name: name, Pattern: pattern, Author: evt.Sender}
+	if existing, err := b.store.GetTriageRule(ctx, name); err == nil {
+		rule.CreatedAt = existing.CreatedAt
+	}
+	if err := b.parseTriageActions(ctx, rule, actions); err != nil {
+		b.SendNotice(ctx, evt.RoomID, err.Error(), nil, relatesTo)
+		return
+	}
+	if err := b.store.SaveTriageRule(ctx, rule); err != nil {
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, "rule `"+name+"` has been saved: `"+pattern+"` → `"+formatTriageActions(rule)+"`", nil, relatesTo)
+}
+
+func (b *Bot) deleteTriageRule(ctx context.Context, evt *event.Event, name string) {
+	relatesTo := linkpearl.EventRelatesTo(evt)
+	if name == "" {
+		b.SendNotice(ctx, evt.RoomID, "Usage: `"+b.prefix+" rule delete NAME`", nil, relatesTo)
+		return
+	}
+	if err := b.store.DeleteTriageRule(ctx, name); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			b.SendNotice(ctx, evt.RoomID, "rule `"+name+"` not found", nil, relatesTo)
+			return
+		}
+		b.SendNotice(ctx, evt.RoomID, linkpearl.UnwrapError(err).Error(), nil, relatesTo)
+		return
+	}
+	b.SendNotice(ctx, evt.RoomID, "rule `"+name+"` has been deleted", nil, relatesTo)
+}
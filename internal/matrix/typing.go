@@ -0,0 +1,113 @@
+package matrix
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/exp/slices"
+	"maunium.net/go/mautrix/event"
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	// typingThrottle is the minimal interval between typing notifications sent into the same room
+	typingThrottle = 3 * time.Second
+	// typingThreadTTL is how long operator typing is relayed to the thread after the last operator message
+	typingThreadTTL = 5 * time.Minute
+)
+
+// typingThread is the last thread where the operator sent a message
+type typingThread struct {
+	ThreadID id.EventID
+	SentAt   time.Time
+}
+
+// forwardTyping relays typing notifications: customer typing is shown as the bot typing in the operators room,
+// operator typing is shown as the bot typing in the customer room.
+// Typing notifications don't contain threads, so operator typing is relayed to the customer of the thread,
+// where the operator sent the last message
+func (b *Bot) forwardTyping(ctx context.Context, evt *event.Event) {
+	content := evt.Content.AsTyping()
+	users := []id.UserID{}
+	for _, userID := range content.UserIDs {
+		if userID != b.lp.GetClient().UserID {
+			users = append(users, userID)
+		}
+	}
+
+	targets := []id.RoomID{}
+	if !b.isOperatorsRoom(ctx, evt.RoomID) {
+		if len(users) > 0 {
+			if ticket, err := b.store.GetOpenTicketByRoom(ctx, evt.RoomID); err == nil {
+				targets = append(targets, b.operatorsRoom(ticket))
+			}
+		}
+		b.relayTyping(ctx, evt.RoomID, targets)
+		return
+	}
+
+	for _, userID := range users {
+		last, ok := b.typingThreads.Get(userID)
+		if !ok {
+			continue
+		}
+		if time.Since(last.SentAt) > typingThreadTTL {
+			b.typingThreads.Remove(userID)
+			continue
+		}
+		ticket, err := b.getTicket(ctx, last.ThreadID)
+		if err != nil || slices.Contains(targets, ticket.RoomID) {
+			continue
+		}
+		targets = append(targets, ticket.RoomID)
+	}
+	b.relayTyping(ctx, evt.RoomID, targets)
+}
+
+// forgetTypingThread stops relaying operator typing to the closed thread
+func (b *Bot) forgetTypingThread(threadID id.EventID) {
+	for _, userID := range b.typingThreads.Keys() {
+		if last, ok := b.typingThreads.Peek(userID); ok && last.ThreadID == threadID {
+			b.typingThreads.Remove(userID)
+		}
+	}
+}
+
+// relayTyping starts typing in the target rooms and stops it in the rooms targeted by the previous notification of the source room
+func (b *Bot) relayTyping(ctx context.Context, sourceID id.RoomID, targets []id.RoomID) {
+	key := "typing_" + sourceID.String()
+	b.mu.Lock(key)
+	defer b.mu.Unlock(key)
+
+	previous, _ := b.typingTargets.Get(sourceID)
+	for _, roomID := range previous {
+		if !slices.Contains(targets, roomID) {
+			b.sendTyping(ctx, roomID, false)
+		}
+	}
+	for _, roomID := range targets {
+		b.sendTyping(ctx, roomID, true)
+	}
+	if len(targets) == 0 {
+		b.typingTargets.Remove(sourceID)
+		return
+	}
+	b.typingTargets.Add(sourceID, targets)
+}
+
+// sendTyping sets the bot typing status in the room, throttled
+func (b *Bot) sendTyping(ctx context.Context, roomID id.RoomID, typing bool) {
+	if !typing {
+		if _, ok := b.typingSent.Peek(roomID); ok {
+			b.typingSent.Remove(roomID)
+			b.lp.SendTyping(ctx, roomID, false)
+		}
+		return
+	}
+
+	if sentAt, ok := b.typingSent.Get(roomID); ok && time.Since(sentAt) < typingThrottle {
+		return
+	}
+	b.typingSent.Add(roomID, time.Now())
+	b.lp.SendTyping(ctx, roomID, true, TypingTimeout/1000) // linkpearl expects seconds
+}
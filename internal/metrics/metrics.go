@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/VictoriaMetrics/metrics"
 	"maunium.net/go/mautrix/id"
@@ -24,10 +25,16 @@ var (
 		"twitter":    true,
 		"whatsapp":   true,
 	}
-	requestsNew      = metrics.NewCounter("honoroit_request_new")
-	requestsDone     = metrics.NewCounter("honoroit_request_done")
-	messagesTotal    = metrics.NewCounter("honoroit_messages_total")
-	messagesOperator = metrics.NewCounter("honoroit_messages_operator")
+	requestsNew         = metrics.NewCounter("honoroit_request_new")
+	requestsDone        = metrics.NewCounter("honoroit_request_done")
+	messagesTotal       = metrics.NewCounter("honoroit_messages_total")
+	messagesOperator    = metrics.NewCounter("honoroit_messages_operator")
+	slaFirstResponse    = metrics.NewHistogram("honoroit_sla_first_response_seconds")
+	slaResolution       = metrics.NewHistogram("honoroit_sla_resolution_seconds")
+	slaResponseBreach   = metrics.NewCounter(`honoroit_sla_breach{sla="response"}`)
+	slaResolutionBreach = metrics.NewCounter(`honoroit_sla_breach{sla="resolution"}`)
+	csatTotal           = metrics.NewCounter("honoroit_csat_total")
+	csatSum             = metrics.NewCounter("honoroit_csat_sum")
 )
 
 // Handler for metrics
@@ -42,14 +49,24 @@ func InitMetrics() {
 	http.Handle("/metrics", &Handler{})
 }
 
-// RequestNew increments count of new requests
-func RequestNew() {
+// RequestNew increments count of new requests, labeled with priority and tags set by the triage rules
+func RequestNew(priority string, tags []string) {
 	requestsNew.Inc()
+
+	metrics.GetOrCreateCounter(fmt.Sprintf("honoroit_request_new_priority{priority=%q}", priority)).Inc()
+	for _, tag := range tags {
+		metrics.GetOrCreateCounter(fmt.Sprintf("honoroit_request_new_tag{tag=%q}", tag)).Inc()
+	}
 }
 
-// RequestDone increments count of closed requests
-func RequestDone() {
+// RequestDone increments count of closed requests, labeled with request priority and tags
+func RequestDone(priority string, tags []string) {
 	requestsDone.Inc()
+
+	metrics.GetOrCreateCounter(fmt.Sprintf("honoroit_request_done_priority{priority=%q}", priority)).Inc()
+	for _, tag := range tags {
+		metrics.GetOrCreateCounter(fmt.Sprintf("honoroit_request_done_tag{tag=%q}", tag)).Inc()
+	}
 }
 
 // MessagesCustomer increments count of messages from customers
@@ -59,7 +76,7 @@ func MessagesCustomer(sender id.UserID) {
 	metrics.GetOrCreateCounter(
 		fmt.Sprintf(
 			"honoroit_messages_customer{source=%q,sender=%q,domain=%q}",
-			getSource(sender), sender.String(), sender.Homeserver(),
+			GetSource(sender), sender.String(), sender.Homeserver(),
 		),
 	).Inc()
 }
@@ -70,7 +87,31 @@ func MessagesOperator() {
 	messagesOperator.Inc()
 }
 
-func getSource(sender id.UserID) string {
+// SLAFirstResponse records time to the first operator reply
+func SLAFirstResponse(duration time.Duration, breached bool) {
+	slaFirstResponse.Update(duration.Seconds())
+	if breached {
+		slaResponseBreach.Inc()
+	}
+}
+
+// SLAResolution records time to the request resolution
+func SLAResolution(duration time.Duration, breached bool) {
+	slaResolution.Update(duration.Seconds())
+	if breached {
+		slaResolutionBreach.Inc()
+	}
+}
+
+// CSAT records customer satisfaction score, average score is honoroit_csat_sum / honoroit_csat_total
+func CSAT(score int) {
+	csatTotal.Inc()
+	csatSum.Add(score)
+	metrics.GetOrCreateCounter(fmt.Sprintf("honoroit_csat{score=\"%d\"}", score)).Inc()
+}
+
+// GetSource returns the bridge of the sender, or "matrix" for native matrix users
+func GetSource(sender id.UserID) string {
 	parts := strings.Split(sender.Localpart(), "_")
 	if len(parts) < 2 {
 		return "matrix"
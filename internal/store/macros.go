@@ -0,0 +1,77 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// Macro is a canned response, sent by operators to customers
+type Macro struct {
+	Name      string
+	Text      string
+	Author    id.UserID
+	UpdatedAt time.Time
+}
+
+// GetMacro by name
+func (s *Store) GetMacro(ctx context.Context, name string) (*Macro, error) {
+	var m Macro
+	var updatedAt int64
+	err := s.db.QueryRowContext(ctx, `SELECT name, text, author, updated_at FROM macros WHERE name = $1`, name).Scan(&m.Name, &m.Text, &m.Author, &updatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	m.UpdatedAt = fromMilli(updatedAt)
+	return &m, nil
+}
+
+// ListMacros returns all macros, sorted by name
+func (s *Store) ListMacros(ctx context.Context) ([]*Macro, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT name, text, author, updated_at FROM macros ORDER BY name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	macros := []*Macro{}
+	for rows.Next() {
+		var m Macro
+		var updatedAt int64
+		if err := rows.Scan(&m.Name, &m.Text, &m.Author, &updatedAt); err != nil {
+			return nil, err
+		}
+		m.UpdatedAt = fromMilli(updatedAt)
+		macros = append(macros, &m)
+	}
+	return macros, rows.Err()
+}
+
+// SaveMacro creates a new macro or overwrites the existing one
+func (s *Store) SaveMacro(ctx context.Context, m *Macro) error {
+	m.UpdatedAt = time.Now().UTC()
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO macros (name, text, author, updated_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET text = excluded.text, author = excluded.author, updated_at = excluded.updated_at`,
+		m.Name, m.Text, m.Author, toMilli(m.UpdatedAt),
+	)
+	return err
+}
+
+// DeleteMacro by name, returns ErrNotFound if there is no such macro
+func (s *Store) DeleteMacro(ctx context.Context, name string) error {
+	deleted, err := rowsUpdated(s.db.ExecContext(ctx, `DELETE FROM macros WHERE name = $1`, name))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// Note is an internal operator note of the ticket, never shown to the customer
+type Note struct {
+	EventID   id.EventID
+	ThreadID  id.EventID
+	Author    id.UserID
+	Body      string
+	CreatedAt time.Time
+}
+
+const noteColumns = `event_id, thread_id, author, body, created_at`
+
+func scanNote(row scanner) (*Note, error) {
+	var n Note
+	var createdAt int64
+	if err := row.Scan(&n.EventID, &n.ThreadID, &n.Author, &n.Body, &createdAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	n.CreatedAt = fromMilli(createdAt)
+	return &n, nil
+}
+
+// AddNote to the ticket, the same note (event) is stored only once
+func (s *Store) AddNote(ctx context.Context, n *Note) error {
+	if n.CreatedAt.IsZero() {
+		n.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO ticket_notes (event_id, thread_id, author, body, created_at) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (event_id) DO NOTHING`,
+		n.EventID, n.ThreadID, n.Author, n.Body, toMilli(n.CreatedAt),
+	)
+	return err
+}
+
+// ListNotes of the ticket, the oldest first
+func (s *Store) ListNotes(ctx context.Context, threadID id.EventID) ([]*Note, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+noteColumns+` FROM ticket_notes WHERE thread_id = $1 ORDER BY created_at ASC`, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*Note{}
+	for rows.Next() {
+		n, err := scanNote(rows)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// GetNote by its event ID
+func (s *Store) GetNote(ctx context.Context, eventID id.EventID) (*Note, error) {
+	return scanNote(s.db.QueryRowContext(ctx, `SELECT `+noteColumns+` FROM ticket_notes WHERE event_id = $1`, eventID))
+}
+
+// DeleteNote by its event ID, returns ErrNotFound if there is no such note
+func (s *Store) DeleteNote(ctx context.Context, eventID id.EventID) error {
+	deleted, err := rowsUpdated(s.db.ExecContext(ctx, `DELETE FROM ticket_notes WHERE event_id = $1`, eventID))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFound
+	}
+	return nil
+}
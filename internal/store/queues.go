@@ -0,0 +1,95 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// Queue is an operators room with its own routing rules, e.g. billing or sales
+type Queue struct {
+	Name      string
+	RoomID    id.RoomID
+	Rules     []string // routing rules in the TYPE:VALUE format, the request is routed to the queue if any of them matches
+	Greetings string   // greetings text sent to the customer, empty means the default greetings
+	Receipts  string   // read receipts reaction, empty means the default reaction, "off" disables read receipts
+	CreatedAt time.Time
+}
+
+const queueColumns = `name, room_id, rules, greetings, receipts, created_at`
+
+func scanQueue(row scanner) (*Queue, error) {
+	var q Queue
+	var rules string
+	var createdAt int64
+	if err := row.Scan(&q.Name, &q.RoomID, &rules, &q.Greetings, &q.Receipts, &createdAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	q.Rules = []string{}
+	if rules != "" {
+		q.Rules = strings.Split(rules, "\n")
+	}
+	q.CreatedAt = fromMilli(createdAt)
+	return &q, nil
+}
+
+// GetQueue by name
+func (s *Store) GetQueue(ctx context.Context, name string) (*Queue, error) {
+	return scanQueue(s.db.QueryRowContext(ctx, `SELECT `+queueColumns+` FROM queues WHERE name = $1`, name))
+}
+
+// GetQueueByRoom returns the queue of the operators room
+func (s *Store) GetQueueByRoom(ctx context.Context, roomID id.RoomID) (*Queue, error) {
+	return scanQueue(s.db.QueryRowContext(ctx, `SELECT `+queueColumns+` FROM queues WHERE room_id = $1`, roomID))
+}
+
+// ListQueues returns all queues in the order of their routing priority (oldest first)
+func (s *Store) ListQueues(ctx context.Context) ([]*Queue, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+queueColumns+` FROM queues ORDER BY created_at ASC, name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	queues := []*Queue{}
+	for rows.Next() {
+		q, err := scanQueue(rows)
+		if err != nil {
+			return nil, err
+		}
+		queues = append(queues, q)
+	}
+	return queues, rows.Err()
+}
+
+// SaveQueue creates a new queue or updates the existing one, the creation time (routing priority) is preserved
+func (s *Store) SaveQueue(ctx context.Context, q *Queue) error {
+	if q.CreatedAt.IsZero() {
+		q.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO queues (`+queueColumns+`) VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (name) DO UPDATE SET room_id = excluded.room_id, rules = excluded.rules, greetings = excluded.greetings, receipts = excluded.receipts`,
+		q.Name, q.RoomID, strings.Join(q.Rules, "\n"), q.Greetings, q.Receipts, toMilli(q.CreatedAt),
+	)
+	return err
+}
+
+// DeleteQueue by name, returns ErrNotFound if there is no such queue
+func (s *Store) DeleteQueue(ctx context.Context, name string) error {
+	deleted, err := rowsUpdated(s.db.ExecContext(ctx, `DELETE FROM queues WHERE name = $1`, name))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// RelayTypeMessage is the default relay event type
+const RelayTypeMessage = "m.room.message"
+
+// Relay maps the original event to its copy, sent by the bot into the other room:
+// customer messages are relayed into the thread, operator messages - into the customer room
+type Relay struct {
+	EventID   id.EventID // original event
+	RelayID   id.EventID // copy of the event
+	ThreadID  id.EventID
+	RoomID    id.RoomID // room of the copy
+	EventType string    // type of the event, m.room.message by default
+	CreatedAt time.Time
+	ReadAt    time.Time // when the copy was read by the customer, operator messages only
+}
+
+const relayColumns = `event_id, relay_id, thread_id, room_id, event_type, created_at, read_at`
+
+func scanRelay(row scanner) (*Relay, error) {
+	var r Relay
+	var createdAt, readAt int64
+	if err := row.Scan(&r.EventID, &r.RelayID, &r.ThreadID, &r.RoomID, &r.EventType, &createdAt, &readAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	r.CreatedAt = fromMilli(createdAt)
+	r.ReadAt = fromMilli(readAt)
+	return &r, nil
+}
+
+// AddRelay of the event
+func (s *Store) AddRelay(ctx context.Context, r *Relay) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	if r.EventType == "" {
+		r.EventType = RelayTypeMessage
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO event_relays (`+relayColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (event_id) DO UPDATE SET relay_id = excluded.relay_id, thread_id = excluded.thread_id, room_id = excluded.room_id, event_type = excluded.event_type`,
+		r.EventID, r.RelayID, r.ThreadID, r.RoomID, r.EventType, toMilli(r.CreatedAt), toMilli(r.ReadAt),
+	)
+	return err
+}
+
+// GetRelay of the original event
+func (s *Store) GetRelay(ctx context.Context, eventID id.EventID) (*Relay, error) {
+	return scanRelay(s.db.QueryRowContext(ctx, `SELECT `+relayColumns+` FROM event_relays WHERE event_id = $1`, eventID))
+}
+
+// GetRelayByCopy returns the relay of the event copy, i.e. the reverse lookup of GetRelay
+func (s *Store) GetRelayByCopy(ctx context.Context, relayID id.EventID) (*Relay, error) {
+	return scanRelay(s.db.QueryRowContext(ctx, `SELECT `+relayColumns+` FROM event_relays WHERE relay_id = $1`, relayID))
+}
+
+// ListUnreadRelays returns message copies in the room, that were not read yet and were sent before (and including) the time
+func (s *Store) ListUnreadRelays(ctx context.Context, roomID id.RoomID, before time.Time) ([]*Relay, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT `+relayColumns+` FROM event_relays WHERE room_id = $1 AND event_type = $2 AND read_at = 0 AND created_at <= $3 ORDER BY created_at ASC`,
+		roomID, RelayTypeMessage, toMilli(before),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	relays := []*Relay{}
+	for rows.Next() {
+		r, err := scanRelay(rows)
+		if err != nil {
+			return nil, err
+		}
+		relays = append(relays, r)
+	}
+	return relays, rows.Err()
+}
+
+// SetRelayRead marks the copy as read, returns false if it was read already
+func (s *Store) SetRelayRead(ctx context.Context, eventID id.EventID) (bool, error) {
+	return rowsUpdated(s.db.ExecContext(ctx,
+		`UPDATE event_relays SET read_at = $1 WHERE event_id = $2 AND read_at = 0`,
+		toMilli(time.Now().UTC()), eventID,
+	))
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// searchRowsLimit limits the amount of matching messages, results are grouped by threads afterwards
+const searchRowsLimit = 200
+
+// SearchResult is a ticket matching the search query
+type SearchResult struct {
+	Ticket  *Ticket
+	Snippet string // matching part of the message, with highlighted terms
+}
+
+// IndexMessage adds the message to the full-text search index
+func (s *Store) IndexMessage(ctx context.Context, threadID, eventID id.EventID, body string, ts time.Time) error {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO search_messages (thread_id, event_id, body, created_at) VALUES ($1, $2, $3, $4)`,
+		threadID, eventID, body, toMilli(ts),
+	)
+	return err
+}
+
+// ReplaceIndexedMessage replaces the text of the message in the full-text search index, used for edits,
+// so only the latest version of the message is searchable
+func (s *Store) ReplaceIndexedMessage(ctx context.Context, threadID, eventID id.EventID, body string, ts time.Time) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM search_messages WHERE event_id = $1`, eventID); err != nil {
+		return err
+	}
+	if body = strings.TrimSpace(body); body != "" {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO search_messages (thread_id, event_id, body, created_at) VALUES ($1, $2, $3, $4)`,
+			threadID, eventID, body, toMilli(ts),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// UnindexMessage removes the message from the full-text search index
+func (s *Store) UnindexMessage(ctx context.Context, eventID id.EventID) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM search_messages WHERE event_id = $1`, eventID)
+	return err
+}
+
+// UnindexThread removes all messages of the thread from the full-text search index
+func (s *Store) UnindexThread(ctx context.Context, threadID id.EventID) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM search_messages WHERE thread_id = $1`, threadID)
+	return err
+}
+
+// Search tickets by the text of their messages, the most relevant first
+func (s *Store) Search(ctx context.Context, query string, limit int) ([]*SearchResult, error) {
+	if strings.TrimSpace(query) == "" {
+		return []*SearchResult{}, nil
+	}
+
+	var sqlQuery string
+	var args []any
+	switch s.dialect {
+	case "postgres":
+		sqlQuery = `SELECT m.thread_id, ts_headline('simple', m.body, q, 'StartSel=**, StopSel=**, MaxWords=20, MinWords=5')
+			FROM search_messages m, plainto_tsquery('simple', $1) q
+			WHERE m.tsv @@ q ORDER BY ts_rank(m.tsv, q) DESC, m.created_at DESC LIMIT $2`
+		args = []any{query, searchRowsLimit}
+	default:
+		sqlQuery = `SELECT thread_id, snippet(search_messages, 2, '**', '**', '…', 16)
+			FROM search_messages WHERE search_messages MATCH $1 ORDER BY rank, created_at DESC LIMIT $2`
+		args = []any{ftsQuery(query), searchRowsLimit}
+	}
+
+	rows, err := s.db.QueryContext(ctx, sqlQuery, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snippets := map[id.EventID]string{}
+	threadIDs := []id.EventID{}
+	for rows.Next() {
+		var threadID id.EventID
+		var snippet string
+		if err := rows.Scan(&threadID, &snippet); err != nil {
+			return nil, err
+		}
+		if _, ok := snippets[threadID]; ok {
+			continue
+		}
+		snippets[threadID] = snippet
+		threadIDs = append(threadIDs, threadID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	results := []*SearchResult{}
+	for _, threadID := range threadIDs {
+		if len(results) >= limit {
+			break
+		}
+		ticket, err := s.GetTicket(ctx, threadID)
+		if err != nil {
+			continue // the ticket may be deleted, but the index is not cleaned up until rebuild
+		}
+		results = append(results, &SearchResult{Ticket: ticket, Snippet: snippets[threadID]})
+	}
+	return results, nil
+}
+
+// ftsQuery converts user input into a safe sqlite FTS5 query: all words must be present
+func ftsQuery(query string) string {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// ErrNotFound returned when the requested record doesn't exist
+var ErrNotFound = errors.New("not found")
+
+// migration is a single schema change, applied exactly once
+type migration struct {
+	common   string // query for all dialects
+	sqlite   string // sqlite-specific query, overrides common
+	postgres string // postgres-specific query, overrides common
+}
+
+// migrations are applied in order, never change or remove existing entries - add new ones instead
+var migrations = []migration{
+	{common: `CREATE TABLE IF NOT EXISTS tickets (
+		thread_id TEXT NOT NULL PRIMARY KEY,
+		room_id TEXT NOT NULL,
+		customer TEXT NOT NULL,
+		homeserver TEXT NOT NULL,
+		issue_id BIGINT NOT NULL DEFAULT 0,
+		state TEXT NOT NULL,
+		created_at BIGINT NOT NULL,
+		updated_at BIGINT NOT NULL,
+		closed_at BIGINT NOT NULL DEFAULT 0
+	)`},
+	{common: `CREATE INDEX IF NOT EXISTS tickets_room_id_idx ON tickets (room_id)`},
+	{common: `CREATE INDEX IF NOT EXISTS tickets_customer_idx ON tickets (customer)`},
+	{common: `ALTER TABLE tickets ADD COLUMN assignee TEXT NOT NULL DEFAULT ''`},
+	{common: `ALTER TABLE tickets ADD COLUMN topic TEXT NOT NULL DEFAULT ''`},
+	{common: `ALTER TABLE tickets ADD COLUMN topic_html TEXT NOT NULL DEFAULT ''`},
+	{common: `CREATE INDEX IF NOT EXISTS tickets_assignee_idx ON tickets (assignee)`},
+	{common: `ALTER TABLE tickets ADD COLUMN priority TEXT NOT NULL DEFAULT 'normal'`},
+	{common: `CREATE TABLE IF NOT EXISTS ticket_tags (
+		thread_id TEXT NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (thread_id, tag)
+	)`},
+	{common: `CREATE INDEX IF NOT EXISTS ticket_tags_tag_idx ON ticket_tags (tag)`},
+	{common: `ALTER TABLE tickets ADD COLUMN warned_at BIGINT NOT NULL DEFAULT 0`},
+	{common: `ALTER TABLE tickets ADD COLUMN first_message_at BIGINT NOT NULL DEFAULT 0`},
+	{common: `ALTER TABLE tickets ADD COLUMN first_response_at BIGINT NOT NULL DEFAULT 0`},
+	{common: `ALTER TABLE tickets ADD COLUMN response_warned_at BIGINT NOT NULL DEFAULT 0`},
+	{common: `ALTER TABLE tickets ADD COLUMN resolution_warned_at BIGINT NOT NULL DEFAULT 0`},
+	{common: `ALTER TABLE tickets ADD COLUMN csat_event_id TEXT NOT NULL DEFAULT ''`},
+	{common: `ALTER TABLE tickets ADD COLUMN csat_score INTEGER NOT NULL DEFAULT 0`},
+	{common: `ALTER TABLE tickets ADD COLUMN csat_until BIGINT NOT NULL DEFAULT 0`},
+	{common: `CREATE INDEX IF NOT EXISTS tickets_csat_event_id_idx ON tickets (csat_event_id)`},
+	{common: `CREATE TABLE IF NOT EXISTS macros (
+		name TEXT NOT NULL PRIMARY KEY,
+		text TEXT NOT NULL,
+		author TEXT NOT NULL,
+		updated_at BIGINT NOT NULL
+	)`},
+	{
+		sqlite: `CREATE VIRTUAL TABLE IF NOT EXISTS search_messages USING fts5(
+			thread_id UNINDEXED,
+			event_id UNINDEXED,
+			body,
+			created_at UNINDEXED
+		)`,
+		postgres: `CREATE TABLE IF NOT EXISTS search_messages (
+			thread_id TEXT NOT NULL,
+			event_id TEXT NOT NULL,
+			body TEXT NOT NULL,
+			created_at BIGINT NOT NULL,
+			tsv tsvector GENERATED ALWAYS AS (to_tsvector('simple', body)) STORED
+		)`,
+	},
+	{postgres: `CREATE INDEX IF NOT EXISTS search_messages_tsv_idx ON search_messages USING GIN (tsv)`},
+	{common: `ALTER TABLE tickets ADD COLUMN merged_into TEXT NOT NULL DEFAULT ''`},
+	{common: `ALTER TABLE tickets ADD COLUMN operators_room_id TEXT NOT NULL DEFAULT ''`},
+	{common: `CREATE INDEX IF NOT EXISTS tickets_operators_room_id_idx ON tickets (operators_room_id)`},
+	{common: `CREATE TABLE IF NOT EXISTS queues (
+		name TEXT PRIMARY KEY,
+		room_id TEXT NOT NULL UNIQUE,
+		rules TEXT NOT NULL DEFAULT '',
+		greetings TEXT NOT NULL DEFAULT '',
+		created_at BIGINT NOT NULL
+	)`},
+	{common: `ALTER TABLE tickets ADD COLUMN moved_to TEXT NOT NULL DEFAULT ''`},
+	{common: `CREATE TABLE IF NOT EXISTS triage_rules (
+		name TEXT PRIMARY KEY,
+		pattern TEXT NOT NULL,
+		tag TEXT NOT NULL DEFAULT '',
+		priority TEXT NOT NULL DEFAULT '',
+		queue TEXT NOT NULL DEFAULT '',
+		assignee TEXT NOT NULL DEFAULT '',
+		author TEXT NOT NULL,
+		created_at BIGINT NOT NULL
+	)`},
+	{common: `CREATE TABLE IF NOT EXISTS ticket_notes (
+		event_id TEXT PRIMARY KEY,
+		thread_id TEXT NOT NULL,
+		author TEXT NOT NULL,
+		body TEXT NOT NULL,
+		created_at BIGINT NOT NULL
+	)`},
+	{common: `CREATE INDEX IF NOT EXISTS ticket_notes_thread_id_idx ON ticket_notes (thread_id)`},
+	{common: `CREATE TABLE IF NOT EXISTS event_relays (
+		event_id TEXT PRIMARY KEY,
+		relay_id TEXT NOT NULL,
+		thread_id TEXT NOT NULL,
+		room_id TEXT NOT NULL,
+		created_at BIGINT NOT NULL
+	)`},
+	{common: `CREATE INDEX IF NOT EXISTS event_relays_relay_id_idx ON event_relays (relay_id)`},
+	{common: `ALTER TABLE event_relays ADD COLUMN event_type TEXT NOT NULL DEFAULT 'm.room.message'`},
+	{common: `ALTER TABLE event_relays ADD COLUMN read_at BIGINT NOT NULL DEFAULT 0`},
+	{common: `CREATE INDEX IF NOT EXISTS event_relays_room_id_idx ON event_relays (room_id)`},
+	{common: `ALTER TABLE queues ADD COLUMN receipts TEXT NOT NULL DEFAULT ''`},
+}
+
+// Store of honoroit data, backed by the same database linkpearl uses
+type Store struct {
+	db      *sql.DB
+	dialect string
+}
+
+// New creates a new store and applies pending migrations
+func New(db *sql.DB, dialect string) (*Store, error) {
+	if dialect == "sqlite3" {
+		dialect = "sqlite"
+	}
+	s := &Store{db: db, dialect: dialect}
+	if err := s.migrate(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (m migration) query(dialect string) string {
+	switch dialect {
+	case "sqlite":
+		if m.sqlite != "" {
+			return m.sqlite
+		}
+	case "postgres":
+		if m.postgres != "" {
+			return m.postgres
+		}
+	}
+	return m.common
+}
+
+func (s *Store) migrate(ctx context.Context) error {
+	if _, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS honoroit_version (version INTEGER NOT NULL)`); err != nil {
+		return err
+	}
+
+	var version int
+	err := s.db.QueryRowContext(ctx, `SELECT version FROM honoroit_version LIMIT 1`).Scan(&version)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	isNew := errors.Is(err, sql.ErrNoRows)
+
+	for i := version; i < len(migrations); i++ {
+		if err := s.apply(ctx, migrations[i], i+1, isNew); err != nil {
+			return err
+		}
+		isNew = false
+	}
+	return nil
+}
+
+func (s *Store) apply(ctx context.Context, m migration, version int, isNew bool) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	if query := m.query(s.dialect); query != "" {
+		if _, err := tx.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	if isNew {
+		_, err = tx.ExecContext(ctx, `INSERT INTO honoroit_version (version) VALUES ($1)`, version)
+	} else {
+		_, err = tx.ExecContext(ctx, `UPDATE honoroit_version SET version = $1`, version)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
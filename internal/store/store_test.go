@@ -0,0 +1,420 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+	"maunium.net/go/mautrix/id"
+	_ "modernc.org/sqlite"
+)
+
+type storeSuite struct {
+	suite.Suite
+	db    *sql.DB
+	store *Store
+}
+
+func (s *storeSuite) SetupTest() {
+	s.T().Helper()
+	db, err := sql.Open("sqlite", ":memory:")
+	s.Require().NoError(err)
+	db.SetMaxOpenConns(1)
+	s.db = db
+
+	st, err := New(db, "sqlite3")
+	s.Require().NoError(err)
+	s.store = st
+}
+
+func (s *storeSuite) TearDownTest() {
+	s.T().Helper()
+	s.db.Close()
+}
+
+func (s *storeSuite) TestMigrateIdempotent() {
+	_, err := New(s.db, "sqlite")
+	s.Require().NoError(err)
+
+	var version int
+	s.Require().NoError(s.db.QueryRow(`SELECT version FROM honoroit_version`).Scan(&version))
+	s.Equal(len(migrations), version)
+}
+
+func (s *storeSuite) TestTickets() {
+	ctx := context.Background()
+	ticket := &Ticket{
+		ThreadID:   "$thread",
+		RoomID:     "!room:example.com",
+		Customer:   "@user:example.com",
+		Homeserver: "example.com",
+		IssueID:    42,
+	}
+	s.Require().NoError(s.store.AddTicket(ctx, ticket))
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$thread", RoomID: "!other:example.com"}))
+
+	stored, err := s.store.GetTicket(ctx, "$thread")
+	s.Require().NoError(err)
+	s.Equal(id.RoomID("!room:example.com"), stored.RoomID)
+	s.Equal(int64(42), stored.IssueID)
+	s.Equal(StateOpen, stored.State)
+	s.Equal(PriorityNormal, stored.Priority)
+	s.False(stored.CreatedAt.IsZero())
+
+	byRoom, err := s.store.GetOpenTicketByRoom(ctx, "!room:example.com")
+	s.Require().NoError(err)
+	s.Equal(id.EventID("$thread"), byRoom.ThreadID)
+
+	s.Require().NoError(s.store.SetState(ctx, "$thread", StateDone))
+	_, err = s.store.GetOpenTicketByRoom(ctx, "!room:example.com")
+	s.ErrorIs(err, ErrNotFound)
+
+	closed, err := s.store.GetTicket(ctx, "$thread")
+	s.Require().NoError(err)
+	s.False(closed.IsOpen())
+	s.False(closed.ClosedAt.IsZero())
+
+	open, err := s.store.ListOpenTickets(ctx)
+	s.Require().NoError(err)
+	s.Empty(open)
+
+	s.Require().NoError(s.store.AddTag(ctx, "$thread", "dns"))
+	s.Require().NoError(s.store.AddTag(ctx, "$thread", "billing"))
+	s.Require().NoError(s.store.AddTag(ctx, "$thread", "dns"))
+	tags, err := s.store.GetTags(ctx, "$thread")
+	s.Require().NoError(err)
+	s.Equal([]string{"billing", "dns"}, tags)
+	s.Require().NoError(s.store.RemoveTag(ctx, "$thread", "dns"))
+	tags, err = s.store.GetTags(ctx, "$thread")
+	s.Require().NoError(err)
+	s.Equal([]string{"billing"}, tags)
+
+	s.Require().NoError(s.store.AddNote(ctx, &Note{EventID: "$note", ThreadID: "$thread", Author: "@op:example.com", Body: "internal"}))
+	s.Require().NoError(s.store.AddRelay(ctx, &Relay{EventID: "$customer", RelayID: "$copy", ThreadID: "$thread", RoomID: "!operators:example.com"}))
+	s.Require().NoError(s.store.IndexMessage(ctx, "$thread", "$customer", "cannot login", time.Now().UTC()))
+
+	s.Require().NoError(s.store.DeleteTicket(ctx, "$thread"))
+	_, err = s.store.GetTicket(ctx, "$thread")
+	s.ErrorIs(err, ErrNotFound)
+	tags, err = s.store.GetTags(ctx, "$thread")
+	s.Require().NoError(err)
+	s.Empty(tags)
+	notes, err := s.store.ListNotes(ctx, "$thread")
+	s.Require().NoError(err)
+	s.Empty(notes)
+	_, err = s.store.GetRelay(ctx, "$customer")
+	s.ErrorIs(err, ErrNotFound)
+	var indexed int
+	s.Require().NoError(s.store.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM search_messages WHERE thread_id = $1`, "$thread").Scan(&indexed))
+	s.Zero(indexed)
+}
+
+func (s *storeSuite) TestSLATimestamps() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$thread", RoomID: "!room:example.com"}))
+
+	first := time.UnixMilli(1700000000000).UTC()
+	updated, err := s.store.SetFirstResponseAt(ctx, "$thread", first)
+	s.Require().NoError(err)
+	s.False(updated, "response without customer message should be ignored")
+
+	updated, err = s.store.SetFirstMessageAt(ctx, "$thread", first)
+	s.Require().NoError(err)
+	s.True(updated)
+	updated, err = s.store.SetFirstMessageAt(ctx, "$thread", first.Add(time.Hour))
+	s.Require().NoError(err)
+	s.False(updated)
+
+	updated, err = s.store.SetFirstResponseAt(ctx, "$thread", first.Add(time.Minute))
+	s.Require().NoError(err)
+	s.True(updated)
+	updated, err = s.store.SetFirstResponseAt(ctx, "$thread", first.Add(time.Hour))
+	s.Require().NoError(err)
+	s.False(updated)
+
+	ticket, err := s.store.GetTicket(ctx, "$thread")
+	s.Require().NoError(err)
+	s.Equal(first, ticket.FirstMessageAt)
+	s.Equal(first.Add(time.Minute), ticket.FirstResponseAt)
+}
+
+func (s *storeSuite) TestMerged() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$source", RoomID: "!room:example.com"}))
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$target", RoomID: "!other:example.com"}))
+
+	s.Require().NoError(s.store.SetMerged(ctx, "$source", "$target"))
+	s.Require().NoError(s.store.SetRoomID(ctx, "$target", "!room:example.com"))
+
+	source, err := s.store.GetTicket(ctx, "$source")
+	s.Require().NoError(err)
+	s.False(source.IsOpen())
+	s.Equal(StateMerged, source.State)
+	s.Equal("$target", source.MergedInto.String())
+	s.False(source.ClosedAt.IsZero())
+
+	open, err := s.store.GetOpenTicketByRoom(ctx, "!room:example.com")
+	s.Require().NoError(err)
+	s.Equal("$target", open.ThreadID.String())
+}
+
+func (s *storeSuite) TestMoved() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$source", RoomID: "!room:example.com", Customer: "@customer:example.com"}))
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$target", RoomID: "!room:example.com", Customer: "@customer:example.com", OperatorsRoomID: "!billing:example.com"}))
+	s.Require().NoError(s.store.SetMoved(ctx, "$source", "$target"))
+
+	source, err := s.store.GetTicket(ctx, "$source")
+	s.Require().NoError(err)
+	s.False(source.IsOpen())
+	s.Equal(id.EventID("$target"), source.MovedTo)
+
+	open, err := s.store.GetOpenTicketByRoom(ctx, "!room:example.com")
+	s.Require().NoError(err)
+	s.Equal(id.EventID("$target"), open.ThreadID)
+
+	count, err := s.store.CountCustomerTickets(ctx, "@customer:example.com", time.Now().UTC())
+	s.Require().NoError(err)
+	s.Equal(1, count, "moved ticket should not be counted twice")
+}
+
+func (s *storeSuite) TestCSAT() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$thread", RoomID: "!room:example.com"}))
+	s.Require().NoError(s.store.SetState(ctx, "$thread", StateDone))
+
+	now := time.Now().UTC()
+	s.Require().NoError(s.store.SetCSATPending(ctx, "$thread", "$survey", now.Add(time.Hour)))
+	pending, err := s.store.GetPendingCSATByRoom(ctx, "!room:example.com")
+	s.Require().NoError(err)
+	s.Equal(id.EventID("$survey"), pending.CSATEventID)
+
+	expired, err := s.store.ListExpiredCSAT(ctx, now)
+	s.Require().NoError(err)
+	s.Empty(expired)
+	expired, err = s.store.ListExpiredCSAT(ctx, now.Add(2*time.Hour))
+	s.Require().NoError(err)
+	s.Len(expired, 1)
+
+	stored, err := s.store.SetCSATScore(ctx, "$thread", 4)
+	s.Require().NoError(err)
+	s.True(stored)
+	stored, err = s.store.SetCSATScore(ctx, "$thread", 1)
+	s.Require().NoError(err)
+	s.False(stored)
+
+	ticket, err := s.store.GetTicketByCSATEvent(ctx, "$survey")
+	s.Require().NoError(err)
+	s.Equal(4, ticket.CSATScore)
+	s.True(ticket.CSATUntil.IsZero())
+	_, err = s.store.GetPendingCSATByRoom(ctx, "!room:example.com")
+	s.ErrorIs(err, ErrNotFound)
+}
+
+func (s *storeSuite) TestMacros() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.SaveMacro(ctx, &Macro{Name: "hello", Text: "Hello, {customer}!", Author: "@op:example.com"}))
+	s.Require().NoError(s.store.SaveMacro(ctx, &Macro{Name: "bye", Text: "Bye", Author: "@op:example.com"}))
+	s.Require().NoError(s.store.SaveMacro(ctx, &Macro{Name: "hello", Text: "Hi, {customer}!", Author: "@other:example.com"}))
+
+	macro, err := s.store.GetMacro(ctx, "hello")
+	s.Require().NoError(err)
+	s.Equal("Hi, {customer}!", macro.Text)
+	s.Equal(id.UserID("@other:example.com"), macro.Author)
+
+	macros, err := s.store.ListMacros(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(macros, 2)
+	s.Equal("bye", macros[0].Name)
+
+	s.Require().NoError(s.store.DeleteMacro(ctx, "bye"))
+	s.ErrorIs(s.store.DeleteMacro(ctx, "bye"), ErrNotFound)
+	_, err = s.store.GetMacro(ctx, "bye")
+	s.ErrorIs(err, ErrNotFound)
+}
+
+func (s *storeSuite) TestQueues() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.SaveQueue(ctx, &Queue{Name: "billing", RoomID: "!billing:example.com", Rules: []string{"keyword:invoice"}}))
+	s.Require().NoError(s.store.SaveQueue(ctx, &Queue{Name: "sales", RoomID: "!sales:example.com", CreatedAt: time.Now().UTC().Add(time.Minute)}))
+	s.Require().NoError(s.store.SaveQueue(ctx, &Queue{Name: "billing", RoomID: "!billing:example.com", Rules: []string{"keyword:invoice", "homeserver:example.com"}, Greetings: "Hi", Receipts: "off"}))
+
+	queue, err := s.store.GetQueueByRoom(ctx, "!billing:example.com")
+	s.Require().NoError(err)
+	s.Equal([]string{"keyword:invoice", "homeserver:example.com"}, queue.Rules)
+	s.Equal("Hi", queue.Greetings)
+	s.Equal("off", queue.Receipts)
+
+	queues, err := s.store.ListQueues(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(queues, 2)
+	s.Equal("billing", queues[0].Name, "routing priority should be preserved on update")
+	s.Empty(queues[1].Rules)
+
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$thread", RoomID: "!room:example.com", OperatorsRoomID: "!sales:example.com"}))
+	tickets, err := s.store.ListOpenTicketsByOperatorsRoom(ctx, "!sales:example.com")
+	s.Require().NoError(err)
+	s.Len(tickets, 1)
+
+	s.Require().NoError(s.store.DeleteQueue(ctx, "sales"))
+	s.ErrorIs(s.store.DeleteQueue(ctx, "sales"), ErrNotFound)
+	_, err = s.store.GetQueue(ctx, "sales")
+	s.ErrorIs(err, ErrNotFound)
+}
+
+func (s *storeSuite) TestTriageRules() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.SaveTriageRule(ctx, &TriageRule{Name: "refund", Pattern: "refund", Tag: "billing", Author: "@op:example.com"}))
+	s.Require().NoError(s.store.SaveTriageRule(ctx, &TriageRule{Name: "down", Pattern: "(?i)down|outage", Priority: PriorityUrgent, Author: "@op:example.com", CreatedAt: time.Now().UTC().Add(time.Minute)}))
+	s.Require().NoError(s.store.SaveTriageRule(ctx, &TriageRule{Name: "refund", Pattern: "refund|chargeback", Tag: "billing", Queue: "billing", Author: "@other:example.com"}))
+
+	rule, err := s.store.GetTriageRule(ctx, "refund")
+	s.Require().NoError(err)
+	s.Equal("refund|chargeback", rule.Pattern)
+	s.Equal("billing", rule.Queue)
+
+	rules, err := s.store.ListTriageRules(ctx)
+	s.Require().NoError(err)
+	s.Require().Len(rules, 2)
+	s.Equal("refund", rules[0].Name, "evaluation order should be preserved on update")
+
+	s.Require().NoError(s.store.DeleteTriageRule(ctx, "down"))
+	s.ErrorIs(s.store.DeleteTriageRule(ctx, "down"), ErrNotFound)
+}
+
+func (s *storeSuite) TestNotes() {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	s.Require().NoError(s.store.AddNote(ctx, &Note{EventID: "$2", ThreadID: "$thread", Author: "@op:example.com", Body: "second", CreatedAt: now.Add(time.Minute)}))
+	s.Require().NoError(s.store.AddNote(ctx, &Note{EventID: "$1", ThreadID: "$thread", Author: "@op:example.com", Body: "first", CreatedAt: now}))
+	s.Require().NoError(s.store.AddNote(ctx, &Note{EventID: "$1", ThreadID: "$thread", Author: "@op:example.com", Body: "duplicate"}))
+	s.Require().NoError(s.store.AddNote(ctx, &Note{EventID: "$3", ThreadID: "$other", Author: "@op:example.com", Body: "other"}))
+
+	notes, err := s.store.ListNotes(ctx, "$thread")
+	s.Require().NoError(err)
+	s.Require().Len(notes, 2)
+	s.Equal("first", notes[0].Body)
+	s.Equal("second", notes[1].Body)
+	s.Equal(id.UserID("@op:example.com"), notes[0].Author)
+
+	note, err := s.store.GetNote(ctx, "$1")
+	s.Require().NoError(err)
+	s.Equal(id.EventID("$thread"), note.ThreadID)
+	s.Equal("first", note.Body)
+
+	s.Require().NoError(s.store.DeleteNote(ctx, "$1"))
+	s.ErrorIs(s.store.DeleteNote(ctx, "$1"), ErrNotFound)
+	_, err = s.store.GetNote(ctx, "$1")
+	s.ErrorIs(err, ErrNotFound)
+	notes, err = s.store.ListNotes(ctx, "$thread")
+	s.Require().NoError(err)
+	s.Len(notes, 1)
+}
+
+func (s *storeSuite) TestRelays() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.AddRelay(ctx, &Relay{EventID: "$customer", RelayID: "$copy", ThreadID: "$thread", RoomID: "!operators:example.com"}))
+
+	relay, err := s.store.GetRelay(ctx, "$customer")
+	s.Require().NoError(err)
+	s.Equal(id.EventID("$copy"), relay.RelayID)
+	s.Equal(id.RoomID("!operators:example.com"), relay.RoomID)
+
+	relay, err = s.store.GetRelayByCopy(ctx, "$copy")
+	s.Require().NoError(err)
+	s.Equal(id.EventID("$customer"), relay.EventID)
+	s.Equal(id.EventID("$thread"), relay.ThreadID)
+
+	_, err = s.store.GetRelay(ctx, "$copy")
+	s.ErrorIs(err, ErrNotFound)
+}
+
+func (s *storeSuite) TestUnreadRelays() {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	s.Require().NoError(s.store.AddRelay(ctx, &Relay{EventID: "$op1", RelayID: "$copy1", ThreadID: "$thread", RoomID: "!customer:example.com", CreatedAt: now.Add(-time.Minute)}))
+	s.Require().NoError(s.store.AddRelay(ctx, &Relay{EventID: "$reaction", RelayID: "$copy2", ThreadID: "$thread", RoomID: "!customer:example.com", EventType: "m.reaction", CreatedAt: now.Add(-time.Minute)}))
+	s.Require().NoError(s.store.AddRelay(ctx, &Relay{EventID: "$op2", RelayID: "$copy3", ThreadID: "$thread", RoomID: "!customer:example.com", CreatedAt: now}))
+	s.Require().NoError(s.store.AddRelay(ctx, &Relay{EventID: "$op3", RelayID: "$copy4", ThreadID: "$thread", RoomID: "!customer:example.com", CreatedAt: now.Add(time.Minute)}))
+
+	relays, err := s.store.ListUnreadRelays(ctx, "!customer:example.com", now)
+	s.Require().NoError(err)
+	s.Require().Len(relays, 2, "reactions and newer messages should not be listed")
+	s.Equal(id.EventID("$op1"), relays[0].EventID)
+
+	updated, err := s.store.SetRelayRead(ctx, "$op1")
+	s.Require().NoError(err)
+	s.True(updated)
+	updated, err = s.store.SetRelayRead(ctx, "$op1")
+	s.Require().NoError(err)
+	s.False(updated)
+
+	relays, err = s.store.ListUnreadRelays(ctx, "!customer:example.com", now)
+	s.Require().NoError(err)
+	s.Require().Len(relays, 1)
+	s.Equal(id.EventID("$op2"), relays[0].EventID)
+}
+
+func (s *storeSuite) TestSearch() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$dns", RoomID: "!dns:example.com", Customer: "@dns:example.com"}))
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$mail", RoomID: "!mail:example.com", Customer: "@mail:example.com"}))
+	now := time.Now().UTC()
+	s.Require().NoError(s.store.IndexMessage(ctx, "$dns", "$1", "my DNS records are broken", now))
+	s.Require().NoError(s.store.IndexMessage(ctx, "$dns", "$2", "DNS works now, thanks", now))
+	s.Require().NoError(s.store.IndexMessage(ctx, "$mail", "$3", "cannot send email", now))
+
+	results, err := s.store.Search(ctx, "dns", 10)
+	s.Require().NoError(err)
+	s.Require().Len(results, 1)
+	s.Equal(id.EventID("$dns"), results[0].Ticket.ThreadID)
+	s.Contains(results[0].Snippet, "**DNS**")
+
+	s.Require().NoError(s.store.UnindexMessage(ctx, "$1"))
+	results, err = s.store.Search(ctx, "broken", 10)
+	s.Require().NoError(err)
+	s.Empty(results)
+
+	results, err = s.store.Search(ctx, `"send" OR (`, 10)
+	s.Require().NoError(err)
+	s.Empty(results)
+
+	s.Require().NoError(s.store.UnindexThread(ctx, "$dns"))
+	results, err = s.store.Search(ctx, "dns", 10)
+	s.Require().NoError(err)
+	s.Empty(results)
+	results, err = s.store.Search(ctx, "email", 10)
+	s.Require().NoError(err)
+	s.Len(results, 1)
+
+	s.Require().NoError(s.store.UnindexThread(ctx, "$mail"))
+	results, err = s.store.Search(ctx, "email", 10)
+	s.Require().NoError(err)
+	s.Empty(results)
+}
+
+func (s *storeSuite) TestSearchEdits() {
+	ctx := context.Background()
+	s.Require().NoError(s.store.AddTicket(ctx, &Ticket{ThreadID: "$thread", RoomID: "!room:example.com", Customer: "@customer:example.com"}))
+	now := time.Now().UTC()
+	s.Require().NoError(s.store.IndexMessage(ctx, "$thread", "$original", "my password is hunter2", now))
+	s.Require().NoError(s.store.ReplaceIndexedMessage(ctx, "$thread", "$original", "my password is correcthorse", now.Add(time.Minute)))
+
+	results, err := s.store.Search(ctx, "hunter2", 10)
+	s.Require().NoError(err)
+	s.Empty(results)
+	results, err = s.store.Search(ctx, "correcthorse", 10)
+	s.Require().NoError(err)
+	s.Len(results, 1)
+
+	s.Require().NoError(s.store.UnindexMessage(ctx, "$original"))
+	results, err = s.store.Search(ctx, "password", 10)
+	s.Require().NoError(err)
+	s.Empty(results)
+}
+
+func TestStore(t *testing.T) {
+	suite.Run(t, new(storeSuite))
+}
@@ -0,0 +1,447 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+const (
+	// StateOpen is the state of a ticket that waits for the operator
+	StateOpen = "open"
+	// StateWaiting is the state of a ticket that waits for the customer
+	StateWaiting = "waiting"
+	// StateOnHold is the state of a ticket that was put on hold by the operator
+	StateOnHold = "onhold"
+	// StateEscalated is the state of a ticket that was escalated by the operator
+	StateEscalated = "escalated"
+	// StateDone is the state of a closed ticket
+	StateDone = "done"
+	// StateMerged is the state of a closed ticket that was merged into another one
+	StateMerged = "merged"
+	// StateMoved is the state of a closed ticket that was moved to another queue
+	StateMoved = "moved"
+)
+
+const (
+	// PriorityLow of a ticket
+	PriorityLow = "low"
+	// PriorityNormal of a ticket, default
+	PriorityNormal = "normal"
+	// PriorityHigh of a ticket
+	PriorityHigh = "high"
+	// PriorityUrgent of a ticket
+	PriorityUrgent = "urgent"
+)
+
+var (
+	// States is the list of all ticket states
+	States = []string{StateOpen, StateWaiting, StateOnHold, StateEscalated, StateDone, StateMerged, StateMoved}
+	// Priorities is the list of all ticket priorities, from the lowest to the highest
+	Priorities = []string{PriorityLow, PriorityNormal, PriorityHigh, PriorityUrgent}
+)
+
+const ticketColumns = `thread_id, room_id, customer, homeserver, issue_id, state, created_at, updated_at, closed_at, assignee, topic, topic_html, priority, warned_at, first_message_at, first_response_at, response_warned_at, resolution_warned_at, csat_event_id, csat_score, csat_until, merged_into, operators_room_id, moved_to`
+
+// Ticket is a customer request, represented by a thread in the operators room and a 1:1 room with the customer
+type Ticket struct {
+	ThreadID   id.EventID
+	RoomID     id.RoomID
+	Customer   id.UserID
+	Homeserver string
+	IssueID    int64
+	State      string
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ClosedAt   time.Time
+	Assignee   id.UserID
+	Topic      string // thread topic text without decorations (state prefix, assignee, etc.)
+	TopicHTML  string // formatted thread topic text without decorations
+	Priority   string
+	WarnedAt   time.Time // when the customer was warned about the automatic close
+
+	FirstMessageAt     time.Time // first customer message, SLA start
+	FirstResponseAt    time.Time // first operator reply
+	ResponseWarnedAt   time.Time // when operators were warned about the first response SLA
+	ResolutionWarnedAt time.Time // when operators were warned about the resolution SLA
+
+	CSATEventID id.EventID // customer satisfaction survey event in the customer room
+	CSATScore   int        // customer satisfaction score, 1-5, 0 means no score
+	CSATUntil   time.Time  // until when the survey answer is awaited, zero when not awaited anymore
+
+	MergedInto id.EventID // thread ID of the ticket this one was merged into
+	MovedTo    id.EventID // thread ID of the ticket this one was moved to (in another queue)
+
+	OperatorsRoomID id.RoomID // operators room (queue) of the thread, empty means the default operators room
+}
+
+// IsOpen returns true if the ticket is not closed
+func (t *Ticket) IsOpen() bool {
+	return t.State != StateDone && t.State != StateMerged && t.State != StateMoved
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTicket(row scanner) (*Ticket, error) {
+	var t Ticket
+	var createdAt, updatedAt, closedAt, warnedAt, firstMessageAt, firstResponseAt, responseWarnedAt, resolutionWarnedAt, csatUntil int64
+	err := row.Scan(&t.ThreadID, &t.RoomID, &t.Customer, &t.Homeserver, &t.IssueID, &t.State, &createdAt, &updatedAt, &closedAt, &t.Assignee, &t.Topic, &t.TopicHTML, &t.Priority, &warnedAt, &firstMessageAt, &firstResponseAt, &responseWarnedAt, &resolutionWarnedAt, &t.CSATEventID, &t.CSATScore, &csatUntil, &t.MergedInto, &t.OperatorsRoomID, &t.MovedTo)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	t.CreatedAt = fromMilli(createdAt)
+	t.UpdatedAt = fromMilli(updatedAt)
+	t.ClosedAt = fromMilli(closedAt)
+	t.WarnedAt = fromMilli(warnedAt)
+	t.FirstMessageAt = fromMilli(firstMessageAt)
+	t.FirstResponseAt = fromMilli(firstResponseAt)
+	t.ResponseWarnedAt = fromMilli(responseWarnedAt)
+	t.ResolutionWarnedAt = fromMilli(resolutionWarnedAt)
+	t.CSATUntil = fromMilli(csatUntil)
+	return &t, nil
+}
+
+func (s *Store) queryTickets(ctx context.Context, query string, args ...any) ([]*Ticket, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []*Ticket{}
+	for rows.Next() {
+		t, err := scanTicket(rows)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, t)
+	}
+	return tickets, rows.Err()
+}
+
+// AddTicket stores a new ticket, existing tickets with the same thread ID are left intact
+func (s *Store) AddTicket(ctx context.Context, t *Ticket) error {
+	now := time.Now().UTC()
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = now
+	}
+	if t.UpdatedAt.IsZero() {
+		t.UpdatedAt = now
+	}
+	if t.State == "" {
+		t.State = StateOpen
+	}
+	if t.Priority == "" {
+		t.Priority = PriorityNormal
+	}
+
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO tickets (`+ticketColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24) ON CONFLICT (thread_id) DO NOTHING`,
+		t.ThreadID, t.RoomID, t.Customer, t.Homeserver, t.IssueID, t.State, toMilli(t.CreatedAt), toMilli(t.UpdatedAt), toMilli(t.ClosedAt), t.Assignee, t.Topic, t.TopicHTML, t.Priority, toMilli(t.WarnedAt),
+		toMilli(t.FirstMessageAt), toMilli(t.FirstResponseAt), toMilli(t.ResponseWarnedAt), toMilli(t.ResolutionWarnedAt),
+		t.CSATEventID, t.CSATScore, toMilli(t.CSATUntil), t.MergedInto, t.OperatorsRoomID, t.MovedTo,
+	)
+	return err
+}
+
+// GetTicket by thread ID
+func (s *Store) GetTicket(ctx context.Context, threadID id.EventID) (*Ticket, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+ticketColumns+` FROM tickets WHERE thread_id = $1`, threadID)
+	return scanTicket(row)
+}
+
+// GetOpenTicketByRoom returns the open ticket of the customer room
+func (s *Store) GetOpenTicketByRoom(ctx context.Context, roomID id.RoomID) (*Ticket, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+ticketColumns+` FROM tickets WHERE room_id = $1 AND state NOT IN ($2, $3, $4) ORDER BY created_at DESC LIMIT 1`,
+		roomID, StateDone, StateMerged, StateMoved,
+	)
+	return scanTicket(row)
+}
+
+// ListTickets returns all tickets, including closed ones, oldest first
+func (s *Store) ListTickets(ctx context.Context) ([]*Ticket, error) {
+	return s.queryTickets(ctx, `SELECT `+ticketColumns+` FROM tickets ORDER BY created_at ASC`)
+}
+
+// ListTicketsByCustomer returns all tickets of the customer, including closed ones, newest first
+func (s *Store) ListTicketsByCustomer(ctx context.Context, customer id.UserID) ([]*Ticket, error) {
+	return s.queryTickets(ctx, `SELECT `+ticketColumns+` FROM tickets WHERE customer = $1 ORDER BY created_at DESC`, customer)
+}
+
+// ListOpenTickets returns all tickets that are not closed yet, oldest first
+func (s *Store) ListOpenTickets(ctx context.Context) ([]*Ticket, error) {
+	return s.queryTickets(ctx, `SELECT `+ticketColumns+` FROM tickets WHERE state NOT IN ($1, $2, $3) ORDER BY created_at ASC`, StateDone, StateMerged, StateMoved)
+}
+
+// ListOpenTicketsByOperatorsRoom returns all tickets of the operators room (queue) that are not closed yet, oldest first
+func (s *Store) ListOpenTicketsByOperatorsRoom(ctx context.Context, roomID id.RoomID) ([]*Ticket, error) {
+	return s.queryTickets(ctx, `SELECT `+ticketColumns+` FROM tickets WHERE operators_room_id = $1 AND state NOT IN ($2, $3, $4) ORDER BY created_at ASC`, roomID, StateDone, StateMerged, StateMoved)
+}
+
+// ListOpenTicketsByAssignee returns all tickets assigned to the operator that are not closed yet, oldest first
+func (s *Store) ListOpenTicketsByAssignee(ctx context.Context, assignee id.UserID) ([]*Ticket, error) {
+	return s.queryTickets(ctx,
+		`SELECT `+ticketColumns+` FROM tickets WHERE assignee = $1 AND state NOT IN ($2, $3, $4) ORDER BY created_at ASC`,
+		assignee, StateDone, StateMerged, StateMoved,
+	)
+}
+
+// CountCustomerTickets returns count of the customer tickets created before (and including) the time,
+// moved tickets are not counted, because they are continued by another ticket
+func (s *Store) CountCustomerTickets(ctx context.Context, customer id.UserID, before time.Time) (int, error) {
+	var count int
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM tickets WHERE customer = $1 AND created_at <= $2 AND state != $3`, customer, toMilli(before), StateMoved).Scan(&count)
+	return count, err
+}
+
+// SetState of the ticket, closing timestamp is set automatically when the ticket is closed
+func (s *Store) SetState(ctx context.Context, threadID id.EventID, state string) error {
+	now := toMilli(time.Now().UTC())
+	var closedAt int64
+	if state == StateDone || state == StateMerged || state == StateMoved {
+		closedAt = now
+	}
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET state = $1, updated_at = $2, closed_at = $3 WHERE thread_id = $4`,
+		state, now, closedAt, threadID,
+	)
+	return err
+}
+
+// SetMerged marks the ticket as merged into another one
+func (s *Store) SetMerged(ctx context.Context, threadID, mergedInto id.EventID) error {
+	now := toMilli(time.Now().UTC())
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET state = $1, merged_into = $2, updated_at = $3, closed_at = $4 WHERE thread_id = $5`,
+		StateMerged, mergedInto, now, now, threadID,
+	)
+	return err
+}
+
+// SetMoved marks the ticket as moved to another queue
+func (s *Store) SetMoved(ctx context.Context, threadID, movedTo id.EventID) error {
+	now := toMilli(time.Now().UTC())
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET state = $1, moved_to = $2, updated_at = $3, closed_at = $4 WHERE thread_id = $5`,
+		StateMoved, movedTo, now, now, threadID,
+	)
+	return err
+}
+
+// SetIssueID links the ticket with the redmine issue
+func (s *Store) SetIssueID(ctx context.Context, threadID id.EventID, issueID int64) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET issue_id = $1, updated_at = $2 WHERE thread_id = $3`,
+		issueID, toMilli(time.Now().UTC()), threadID,
+	)
+	return err
+}
+
+// SetRoomID changes the customer room of the ticket
+func (s *Store) SetRoomID(ctx context.Context, threadID id.EventID, roomID id.RoomID) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET room_id = $1, updated_at = $2 WHERE thread_id = $3`,
+		roomID, toMilli(time.Now().UTC()), threadID,
+	)
+	return err
+}
+
+// SetOperatorsRoomID changes the operators room (queue) of the ticket
+func (s *Store) SetOperatorsRoomID(ctx context.Context, threadID id.EventID, roomID id.RoomID) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET operators_room_id = $1, updated_at = $2 WHERE thread_id = $3`,
+		roomID, toMilli(time.Now().UTC()), threadID,
+	)
+	return err
+}
+
+// SetAssignee of the ticket, empty assignee means unassigned ticket
+func (s *Store) SetAssignee(ctx context.Context, threadID id.EventID, assignee id.UserID) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET assignee = $1, updated_at = $2 WHERE thread_id = $3`,
+		assignee, toMilli(time.Now().UTC()), threadID,
+	)
+	return err
+}
+
+// SetTopic of the ticket
+func (s *Store) SetTopic(ctx context.Context, threadID id.EventID, topic, topicHTML string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET topic = $1, topic_html = $2, updated_at = $3 WHERE thread_id = $4`,
+		topic, topicHTML, toMilli(time.Now().UTC()), threadID,
+	)
+	return err
+}
+
+// SetPriority of the ticket
+func (s *Store) SetPriority(ctx context.Context, threadID id.EventID, priority string) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET priority = $1, updated_at = $2 WHERE thread_id = $3`,
+		priority, toMilli(time.Now().UTC()), threadID,
+	)
+	return err
+}
+
+// SetWarnedAt stores the time when the customer was warned about the automatic close
+func (s *Store) SetWarnedAt(ctx context.Context, threadID id.EventID, warnedAt time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE tickets SET warned_at = $1 WHERE thread_id = $2`, toMilli(warnedAt), threadID)
+	return err
+}
+
+// SetFirstMessageAt stores the time of the first customer message, if it's not set yet.
+// Returns true if the value was updated
+func (s *Store) SetFirstMessageAt(ctx context.Context, threadID id.EventID, at time.Time) (bool, error) {
+	return rowsUpdated(s.db.ExecContext(ctx,
+		`UPDATE tickets SET first_message_at = $1 WHERE thread_id = $2 AND first_message_at = 0`,
+		toMilli(at), threadID,
+	))
+}
+
+// SetFirstResponseAt stores the time of the first operator reply, if it's not set yet and the customer already wrote something.
+// Returns true if the value was updated
+func (s *Store) SetFirstResponseAt(ctx context.Context, threadID id.EventID, at time.Time) (bool, error) {
+	return rowsUpdated(s.db.ExecContext(ctx,
+		`UPDATE tickets SET first_response_at = $1 WHERE thread_id = $2 AND first_message_at != 0 AND first_response_at = 0`,
+		toMilli(at), threadID,
+	))
+}
+
+// SetResponseWarnedAt stores the time when operators were warned about the first response SLA
+func (s *Store) SetResponseWarnedAt(ctx context.Context, threadID id.EventID, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE tickets SET response_warned_at = $1 WHERE thread_id = $2`, toMilli(at), threadID)
+	return err
+}
+
+// SetResolutionWarnedAt stores the time when operators were warned about the resolution SLA
+func (s *Store) SetResolutionWarnedAt(ctx context.Context, threadID id.EventID, at time.Time) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE tickets SET resolution_warned_at = $1 WHERE thread_id = $2`, toMilli(at), threadID)
+	return err
+}
+
+// GetTicketByCSATEvent returns the ticket by its customer satisfaction survey event
+func (s *Store) GetTicketByCSATEvent(ctx context.Context, eventID id.EventID) (*Ticket, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+ticketColumns+` FROM tickets WHERE csat_event_id = $1`, eventID)
+	return scanTicket(row)
+}
+
+// GetPendingCSATByRoom returns the ticket of the customer room that awaits the survey answer
+func (s *Store) GetPendingCSATByRoom(ctx context.Context, roomID id.RoomID) (*Ticket, error) {
+	row := s.db.QueryRowContext(ctx,
+		`SELECT `+ticketColumns+` FROM tickets WHERE room_id = $1 AND csat_until != 0 ORDER BY closed_at DESC LIMIT 1`,
+		roomID,
+	)
+	return scanTicket(row)
+}
+
+// ListExpiredCSAT returns tickets that didn't receive the survey answer in time
+func (s *Store) ListExpiredCSAT(ctx context.Context, now time.Time) ([]*Ticket, error) {
+	return s.queryTickets(ctx,
+		`SELECT `+ticketColumns+` FROM tickets WHERE csat_until != 0 AND csat_until < $1 ORDER BY csat_until ASC`,
+		toMilli(now),
+	)
+}
+
+// SetCSATPending stores the survey event and the time until the answer is awaited
+func (s *Store) SetCSATPending(ctx context.Context, threadID id.EventID, eventID id.EventID, until time.Time) error {
+	_, err := s.db.ExecContext(ctx,
+		`UPDATE tickets SET csat_event_id = $1, csat_until = $2 WHERE thread_id = $3`,
+		eventID, toMilli(until), threadID,
+	)
+	return err
+}
+
+// SetCSATScore stores the survey answer, only the first answer is accepted.
+// Returns true if the score was stored
+func (s *Store) SetCSATScore(ctx context.Context, threadID id.EventID, score int) (bool, error) {
+	return rowsUpdated(s.db.ExecContext(ctx,
+		`UPDATE tickets SET csat_score = $1, csat_until = 0 WHERE thread_id = $2 AND csat_score = 0`,
+		score, threadID,
+	))
+}
+
+// ExpireCSAT stops awaiting the survey answer.
+// Returns true if the answer was awaited
+func (s *Store) ExpireCSAT(ctx context.Context, threadID id.EventID) (bool, error) {
+	return rowsUpdated(s.db.ExecContext(ctx, `UPDATE tickets SET csat_until = 0 WHERE thread_id = $1 AND csat_until != 0`, threadID))
+}
+
+// GetTags of the ticket, sorted alphabetically
+func (s *Store) GetTags(ctx context.Context, threadID id.EventID) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT tag FROM ticket_tags WHERE thread_id = $1 ORDER BY tag ASC`, threadID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// AddTag to the ticket, adding existing tag is no-op
+func (s *Store) AddTag(ctx context.Context, threadID id.EventID, tag string) error {
+	_, err := s.db.ExecContext(ctx, `INSERT INTO ticket_tags (thread_id, tag) VALUES ($1, $2) ON CONFLICT (thread_id, tag) DO NOTHING`, threadID, tag)
+	return err
+}
+
+// RemoveTag from the ticket
+func (s *Store) RemoveTag(ctx context.Context, threadID id.EventID, tag string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM ticket_tags WHERE thread_id = $1 AND tag = $2`, threadID, tag)
+	return err
+}
+
+// DeleteTicket removes the ticket completely, with its tags, notes, relays and search index
+func (s *Store) DeleteTicket(ctx context.Context, threadID id.EventID) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // no-op after commit
+
+	for _, table := range []string{"ticket_tags", "ticket_notes", "event_relays", "search_messages", "tickets"} {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE thread_id = $1`, threadID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func rowsUpdated(result sql.Result, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func toMilli(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMilli(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms).UTC()
+}
@@ -0,0 +1,88 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"maunium.net/go/mautrix/id"
+)
+
+// TriageRule classifies new requests: if the first customer message matches the pattern,
+// the request gets the tag, priority, queue and assignee of the rule (empty fields are not applied)
+type TriageRule struct {
+	Name      string
+	Pattern   string // regular expression
+	Tag       string
+	Priority  string
+	Queue     string
+	Assignee  id.UserID
+	Author    id.UserID
+	CreatedAt time.Time
+}
+
+const triageRuleColumns = `name, pattern, tag, priority, queue, assignee, author, created_at`
+
+func scanTriageRule(row scanner) (*TriageRule, error) {
+	var r TriageRule
+	var createdAt int64
+	if err := row.Scan(&r.Name, &r.Pattern, &r.Tag, &r.Priority, &r.Queue, &r.Assignee, &r.Author, &createdAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	r.CreatedAt = fromMilli(createdAt)
+	return &r, nil
+}
+
+// GetTriageRule by name
+func (s *Store) GetTriageRule(ctx context.Context, name string) (*TriageRule, error) {
+	return scanTriageRule(s.db.QueryRowContext(ctx, `SELECT `+triageRuleColumns+` FROM triage_rules WHERE name = $1`, name))
+}
+
+// ListTriageRules returns all triage rules in the order of evaluation (oldest first)
+func (s *Store) ListTriageRules(ctx context.Context) ([]*TriageRule, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+triageRuleColumns+` FROM triage_rules ORDER BY created_at ASC, name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []*TriageRule{}
+	for rows.Next() {
+		r, err := scanTriageRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+// SaveTriageRule creates a new triage rule or overwrites the existing one, the creation time (evaluation order) is preserved
+func (s *Store) SaveTriageRule(ctx context.Context, r *TriageRule) error {
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	_, err := s.db.ExecContext(ctx,
+		`INSERT INTO triage_rules (`+triageRuleColumns+`) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (name) DO UPDATE SET pattern = excluded.pattern, tag = excluded.tag, priority = excluded.priority,
+		queue = excluded.queue, assignee = excluded.assignee, author = excluded.author`,
+		r.Name, r.Pattern, r.Tag, r.Priority, r.Queue, r.Assignee, r.Author, toMilli(r.CreatedAt),
+	)
+	return err
+}
+
+// DeleteTriageRule by name, returns ErrNotFound if there is no such rule
+func (s *Store) DeleteTriageRule(ctx context.Context, name string) error {
+	deleted, err := rowsUpdated(s.db.ExecContext(ctx, `DELETE FROM triage_rules WHERE name = $1`, name))
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrNotFound
+	}
+	return nil
+}